@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+-- Custom aliases can be longer than the generated ids
+ALTER TABLE links ALTER COLUMN short_id TYPE VARCHAR(64);
+
+---- create above / drop below ----
+
+ALTER TABLE links ALTER COLUMN short_id TYPE VARCHAR(10);
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
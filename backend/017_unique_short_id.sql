@@ -0,0 +1,19 @@
+-- Write your migrate up statements here
+-- Give duplicated short ids a unique suffix before adding the unique index
+UPDATE links SET short_id = short_id || '-' || id
+WHERE id IN (
+    SELECT id FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY short_id ORDER BY id) AS row_number
+        FROM links
+    ) duplicates
+    WHERE row_number > 1
+);
+
+CREATE UNIQUE INDEX idx_links_short_id ON links(short_id);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_links_short_id;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
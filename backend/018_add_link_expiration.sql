@@ -0,0 +1,24 @@
+-- Write your migrate up statements here
+ALTER TABLE links ADD COLUMN expires_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE links ADD COLUMN max_clicks INTEGER;
+ALTER TABLE links ADD COLUMN fallback_url TEXT;
+ALTER TABLE links ADD COLUMN expired_at TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE links
+ADD CONSTRAINT chk_links_max_clicks
+CHECK (max_clicks IS NULL OR max_clicks > 0);
+
+-- The expiry sweeper only looks at links that have not been marked yet
+CREATE INDEX idx_links_expires_at ON links(expires_at) WHERE expired_at IS NULL;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_links_expires_at;
+ALTER TABLE links DROP CONSTRAINT IF EXISTS chk_links_max_clicks;
+ALTER TABLE links DROP COLUMN expired_at;
+ALTER TABLE links DROP COLUMN fallback_url;
+ALTER TABLE links DROP COLUMN max_clicks;
+ALTER TABLE links DROP COLUMN expires_at;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,11 @@
+-- Write your migrate up statements here
+ALTER TABLE links ADD COLUMN password_hash TEXT;
+ALTER TABLE clicks ADD COLUMN password_passed BOOLEAN NOT NULL DEFAULT FALSE;
+
+---- create above / drop below ----
+
+ALTER TABLE clicks DROP COLUMN password_passed;
+ALTER TABLE links DROP COLUMN password_hash;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
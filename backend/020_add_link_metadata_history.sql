@@ -0,0 +1,25 @@
+-- Write your migrate up statements here
+ALTER TABLE links ADD COLUMN title TEXT;
+ALTER TABLE links ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE link_history (
+    id SERIAL PRIMARY KEY,
+    link_id INTEGER NOT NULL,
+    event VARCHAR(32) NOT NULL,
+    old_value TEXT,
+    new_value TEXT,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_link_history_link_id ON link_history(link_id);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS link_history;
+ALTER TABLE links DROP COLUMN tags;
+ALTER TABLE links DROP COLUMN title;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,28 @@
+-- Write your migrate up statements here
+CREATE TABLE domains (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    hostname VARCHAR(253) NOT NULL UNIQUE,
+    verification_token VARCHAR(64) NOT NULL,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_domains_user_id ON domains(user_id);
+
+-- Links without a domain use the default domain of the service
+ALTER TABLE links ADD COLUMN domain_id INTEGER REFERENCES domains(id) ON DELETE RESTRICT;
+
+-- The same short id can exist once per domain
+DROP INDEX IF EXISTS idx_links_short_id;
+CREATE UNIQUE INDEX idx_links_domain_short_id ON links((COALESCE(domain_id, 0)), short_id);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_links_domain_short_id;
+CREATE UNIQUE INDEX idx_links_short_id ON links(short_id);
+ALTER TABLE links DROP COLUMN domain_id;
+DROP TABLE IF EXISTS domains;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
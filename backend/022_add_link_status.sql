@@ -0,0 +1,22 @@
+-- Write your migrate up statements here
+ALTER TABLE links ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active';
+ALTER TABLE links ADD CONSTRAINT links_status_check CHECK (status IN ('active', 'paused', 'disabled'));
+
+-- Owners can replace the pages shown for their unavailable links
+CREATE TABLE page_templates (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    page VARCHAR(16) NOT NULL,
+    body TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, page)
+);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS page_templates;
+ALTER TABLE links DROP CONSTRAINT IF EXISTS links_status_check;
+ALTER TABLE links DROP COLUMN status;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+-- Paused links redirect to paused_url when it is set, otherwise the paused page is shown
+ALTER TABLE links ADD COLUMN paused_url TEXT;
+ALTER TABLE links ADD COLUMN paused_clicks INTEGER NOT NULL DEFAULT 0;
+
+-- Hits on paused links are kept apart from regular clicks in the statistics
+ALTER TABLE clicks ADD COLUMN paused BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE clicks DROP COLUMN paused;
+ALTER TABLE links DROP COLUMN paused_clicks;
+ALTER TABLE links DROP COLUMN paused_url;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,13 @@
+-- Write your migrate up statements here
+-- Deleted links stay in the table until the purge job removes them, so their short ids stay reserved
+ALTER TABLE links ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_links_deleted_at ON links(deleted_at) WHERE deleted_at IS NOT NULL;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_links_deleted_at;
+ALTER TABLE links DROP COLUMN deleted_at;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,24 @@
+-- Write your migrate up statements here
+-- Rules are evaluated in ascending priority, the first matching rule wins
+ALTER TABLE redirects ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+
+-- Keep the previous behaviour for existing rules, header rules were checked before cookie rules
+UPDATE redirects
+SET priority = ordered.position
+FROM (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY link_id ORDER BY target_type = 'cookie', id) - 1 AS position
+    FROM redirects
+) ordered
+WHERE redirects.id = ordered.id;
+
+DROP INDEX IF EXISTS idx_redirects_link_id;
+CREATE INDEX idx_redirects_link_id_priority ON redirects(link_id, priority);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_redirects_link_id_priority;
+CREATE INDEX idx_redirects_link_id ON redirects(link_id);
+ALTER TABLE redirects DROP COLUMN priority;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
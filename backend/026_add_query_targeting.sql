@@ -0,0 +1,20 @@
+-- Write your migrate up statements here
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query'));
+
+-- Append the query string of the short link to the destination
+ALTER TABLE links ADD COLUMN forward_query BOOLEAN NOT NULL DEFAULT false;
+
+---- create above / drop below ----
+
+ALTER TABLE links DROP COLUMN forward_query;
+DELETE FROM redirects WHERE target_type = 'query';
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie'));
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
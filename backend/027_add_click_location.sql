@@ -0,0 +1,21 @@
+-- Write your migrate up statements here
+ALTER TABLE clicks ADD COLUMN region VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN city VARCHAR(100) NOT NULL DEFAULT '';
+
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query', 'country'));
+
+---- create above / drop below ----
+
+DELETE FROM redirects WHERE target_type = 'country';
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query'));
+ALTER TABLE clicks DROP COLUMN city;
+ALTER TABLE clicks DROP COLUMN region;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,16 @@
+-- Write your migrate up statements here
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query', 'country', 'device', 'os', 'browser'));
+
+---- create above / drop below ----
+
+DELETE FROM redirects WHERE target_type IN ('device', 'os', 'browser');
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query', 'country'));
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,20 @@
+-- Write your migrate up statements here
+-- Schedule rules keep their time window as JSON, see repository.Schedule
+ALTER TABLE redirects ADD COLUMN schedule JSONB;
+
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query', 'country', 'device', 'os', 'browser', 'schedule'));
+
+---- create above / drop below ----
+
+DELETE FROM redirects WHERE target_type = 'schedule';
+ALTER TABLE redirects DROP CONSTRAINT check_target_type;
+ALTER TABLE redirects
+ADD CONSTRAINT check_target_type
+CHECK (target_type IN ('header', 'cookie', 'query', 'country', 'device', 'os', 'browser'));
+ALTER TABLE redirects DROP COLUMN schedule;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
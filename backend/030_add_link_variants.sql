@@ -0,0 +1,26 @@
+-- Write your migrate up statements here
+-- Links with variants split their traffic across the variant urls by weight instead of going to original
+CREATE TABLE link_variants (
+    id SERIAL PRIMARY KEY,
+    link_id INTEGER NOT NULL,
+    name VARCHAR(64) NOT NULL DEFAULT '',
+    url TEXT NOT NULL,
+    weight INTEGER NOT NULL CHECK (weight > 0),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (link_id) REFERENCES links(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_link_variants_link_id ON link_variants(link_id);
+
+-- No foreign key, clicks still buffered for a variant that was just removed must not fail their whole batch
+ALTER TABLE clicks ADD COLUMN variant_id INTEGER;
+CREATE INDEX idx_clicks_variant_id ON clicks(variant_id) WHERE variant_id IS NOT NULL;
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_clicks_variant_id;
+ALTER TABLE clicks DROP COLUMN variant_id;
+DROP TABLE IF EXISTS link_variants;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,27 @@
+-- Write your migrate up statements here
+-- Rules match on a condition tree, see repository.Condition. The target columns are kept for rules
+-- with a single condition and are NULL for compound rules
+ALTER TABLE redirects ADD COLUMN condition JSONB;
+
+UPDATE redirects
+SET condition = jsonb_strip_nulls(jsonb_build_object(
+    'type', target_type,
+    'method', target_method,
+    'name', target_name,
+    'value', target_value,
+    'schedule', schedule
+));
+
+ALTER TABLE redirects ALTER COLUMN condition SET NOT NULL;
+ALTER TABLE redirects ALTER COLUMN target_type DROP NOT NULL;
+ALTER TABLE redirects ALTER COLUMN target_method DROP NOT NULL;
+
+---- create above / drop below ----
+
+DELETE FROM redirects WHERE target_type IS NULL OR target_method IS NULL;
+ALTER TABLE redirects ALTER COLUMN target_method SET NOT NULL;
+ALTER TABLE redirects ALTER COLUMN target_type SET NOT NULL;
+ALTER TABLE redirects DROP COLUMN condition;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -0,0 +1,47 @@
+-- Write your migrate up statements here
+-- Admins are promoted by hand: UPDATE users SET role = 'admin' WHERE email = '...';
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user';
+ALTER TABLE users ADD CONSTRAINT users_role_check CHECK (role IN ('user', 'admin'));
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE abuse_reports (
+    id SERIAL PRIMARY KEY,
+    link_id INTEGER NOT NULL REFERENCES links(id) ON DELETE CASCADE,
+    reason VARCHAR(16) NOT NULL CHECK (reason IN ('phishing', 'malware', 'spam', 'illegal', 'other')),
+    details TEXT,
+    reporter_email VARCHAR(255),
+    reporter_ip VARCHAR(45) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'actioned', 'dismissed')),
+    decision TEXT,
+    resolved_by UUID REFERENCES users(id),
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_abuse_reports_status ON abuse_reports(status, created_at);
+CREATE INDEX idx_abuse_reports_link_id ON abuse_reports(link_id);
+
+-- The audit log outlives the links and users it mentions, so targets are not foreign keys
+CREATE TABLE audit_log (
+    id SERIAL PRIMARY KEY,
+    actor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    action VARCHAR(32) NOT NULL,
+    target_type VARCHAR(16) NOT NULL,
+    target_id TEXT NOT NULL,
+    details TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_audit_log_created_at ON audit_log(created_at);
+CREATE INDEX idx_audit_log_target ON audit_log(target_type, target_id);
+
+---- create above / drop below ----
+
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS abuse_reports;
+ALTER TABLE users DROP COLUMN suspended_at;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users DROP COLUMN role;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
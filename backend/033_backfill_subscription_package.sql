@@ -0,0 +1,12 @@
+-- Write your migrate up statements here
+-- Subscriptions created before packages were tracked have no package and got the limits of the default
+-- package. Their stripe price is not stored, so they can only be filled in here when a single paid package
+-- exists. The others get their package from the next subscription sync or webhook
+UPDATE subscriptions
+SET package_id = (SELECT id FROM packages WHERE NOT is_default)
+WHERE package_id IS NULL
+AND (SELECT COUNT(*) FROM packages WHERE NOT is_default) = 1;
+
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
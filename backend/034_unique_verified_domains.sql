@@ -0,0 +1,23 @@
+-- Write your migrate up statements here
+-- Only a verified domain claims its hostname, so an unverified registration can not block the real owner
+ALTER TABLE domains DROP CONSTRAINT IF EXISTS domains_hostname_key;
+CREATE UNIQUE INDEX idx_domains_verified_hostname ON domains(hostname) WHERE verified_at IS NOT NULL;
+CREATE UNIQUE INDEX idx_domains_user_hostname ON domains(user_id, hostname);
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_domains_user_hostname;
+DROP INDEX IF EXISTS idx_domains_verified_hostname;
+-- Keep the verified or oldest registration of every hostname
+DELETE FROM domains d
+WHERE EXISTS (
+    SELECT 1 FROM domains other
+    WHERE other.hostname = d.hostname
+    AND other.id <> d.id
+    AND (other.verified_at IS NOT NULL AND d.verified_at IS NULL
+        OR (other.verified_at IS NULL) = (d.verified_at IS NULL) AND other.id < d.id)
+);
+ALTER TABLE domains ADD CONSTRAINT domains_hostname_key UNIQUE (hostname);
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
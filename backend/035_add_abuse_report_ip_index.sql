@@ -0,0 +1,10 @@
+-- Write your migrate up statements here
+-- Open reports are counted per reporter ip before a report is filed
+CREATE INDEX idx_abuse_reports_open_reporter_ip ON abuse_reports(reporter_ip) WHERE status = 'open';
+
+---- create above / drop below ----
+
+DROP INDEX IF EXISTS idx_abuse_reports_open_reporter_ip;
+
+-- Write your migrate down statements here. If this migration is irreversible
+-- Then delete the separator line above.
@@ -1,20 +1,41 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"link-shortener-backend/src/cache"
+	"link-shortener-backend/src/config"
+	"link-shortener-backend/src/geoip"
 	"link-shortener-backend/src/handlers"
+	"link-shortener-backend/src/ingest"
+	"link-shortener-backend/src/jobs"
+	"link-shortener-backend/src/quota"
 	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/safety"
+	"link-shortener-backend/src/shortid"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	// Timezones of schedule rules work without zoneinfo files installed on the host
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	err := godotenv.Load()
+	cfg, err := config.Load(os.Args[1:])
 	if err != nil {
-		fmt.Println("Error loading .env file")
+		fmt.Println(err)
 		return
 	}
+	repository.ShortIds, err = shortid.New(cfg.ShortIdStrategy, cfg.ShortIdSalt, cfg.ShortIdMinLength)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	quota.Policy = quota.OveragePolicy(cfg.ClickOveragePolicy)
+	handlers.Configure(cfg)
 	router := gin.Default()
 
 	router.POST("/api/auth/login", handlers.Login)
@@ -26,31 +47,147 @@ func main() {
 	privateGroup := router.Group("/api/")
 	privateGroup.Use(handlers.AuthMiddleware())
 	privateGroup.POST("/links/create", handlers.CreateLink)
+	privateGroup.POST("/links/bulk", handlers.CreateLinksBulk)
 	privateGroup.POST("/clicks/create", handlers.CreateClick)
 	privateGroup.GET("/links/get/:id", handlers.GetLink)
 	privateGroup.GET("/links/all", handlers.GetAllLinks)
 	privateGroup.DELETE("/links/delete/:id", handlers.DeleteLink)
+	privateGroup.PUT("/links/update/:id", handlers.UpdateLink)
+	privateGroup.GET("/links/history/:id", handlers.GetLinkHistory)
+	privateGroup.POST("/links/:id/pause", handlers.PauseLink)
+	privateGroup.POST("/links/:id/resume", handlers.ResumeLink)
+	privateGroup.GET("/links/:id/variants", handlers.GetVariants)
+	privateGroup.PUT("/links/:id/variants", handlers.SaveVariants)
 	privateGroup.GET("/links/recent", handlers.GetRecentLinks)
+	privateGroup.GET("/links/expired", handlers.GetExpiredLinks)
+	privateGroup.GET("/links/trash", handlers.GetDeletedLinks)
+	privateGroup.POST("/links/restore/:id", handlers.RestoreLink)
 	privateGroup.POST("/redirects/create", handlers.CreateRedirect)
 	privateGroup.GET("/redirects/get/:linkID", handlers.GetRedirectsByLinkID)
 	privateGroup.DELETE("/redirects/delete/:redirectID", handlers.DeleteRedirect)
 	privateGroup.PUT("/redirects/update/:redirectID", handlers.UpdateRedirect)
+	privateGroup.PUT("/redirects/reorder/:linkID", handlers.ReorderRedirects)
+	privateGroup.POST("/redirects/test/:linkID", handlers.TestRedirects)
+	privateGroup.POST("/domains/create", handlers.CreateDomain)
+	privateGroup.GET("/domains/all", handlers.GetDomains)
+	privateGroup.POST("/domains/verify/:id", handlers.VerifyDomain)
+	privateGroup.DELETE("/domains/delete/:id", handlers.DeleteDomain)
+	privateGroup.GET("/pages/all", handlers.GetPageTemplates)
+	privateGroup.PUT("/pages/update/:page", handlers.SavePageTemplate)
+	privateGroup.DELETE("/pages/delete/:page", handlers.DeletePageTemplate)
 	privateGroup.POST("/analytics/get", handlers.GetStatistics)
 	privateGroup.POST("/analytics/daily", handlers.GetDailyStatistics)
 	privateGroup.POST("/analytics/device", handlers.GetDeviceStatistics)
 	privateGroup.POST("/analytics/ip", handlers.GetIpStatistics)
 	privateGroup.POST("/analytics/referer", handlers.GetRefererStatistics)
+	privateGroup.POST("/analytics/variants", handlers.GetVariantStatistics)
 	privateGroup.GET("/analytics/total", handlers.GetTotalStats)
 	// This handles everything related to the shortened link
 	privateGroup.POST("/stripe/create-checkout-session", handlers.StripeCreateCheckoutSession)
 	privateGroup.GET("/stripe/success", handlers.StripeSuccess)
 	privateGroup.GET("/billing/get", handlers.GetBilling)
 	privateGroup.GET("/account/get", handlers.GetAccountDetails)
+
+	// Moderation routes for admins only
+	adminGroup := router.Group("/api/admin/")
+	adminGroup.Use(handlers.AuthMiddleware(), handlers.AdminMiddleware())
+	adminGroup.GET("/reports", handlers.GetAbuseReports)
+	adminGroup.POST("/reports/:id/resolve", handlers.ResolveAbuseReport)
+	adminGroup.POST("/links/:id/disable", handlers.AdminDisableLink)
+	adminGroup.POST("/links/:id/enable", handlers.AdminEnableLink)
+	adminGroup.POST("/users/:id/suspend", handlers.AdminSuspendUser)
+	adminGroup.POST("/users/:id/reinstate", handlers.AdminReinstateUser)
+	adminGroup.GET("/audit", handlers.GetAuditLog)
+
 	router.POST("/api/stripe/webhook", handlers.StripeWebHook)
 	router.GET("/api/stripe/sync", handlers.StripeSubscriptionSync)
+	router.GET("/metrics", handlers.Metrics)
 	router.GET("/:shortId", handlers.Redirect)
+	router.POST("/:shortId", handlers.UnlockLink)
+	router.POST("/report/:shortId", handlers.ReportLink)
 	router.GET("/api/packages/get", handlers.GetPackages)
 
-	repository.InitDatabase()
-	router.Run(":8080")
+	repository.InitDatabase(cfg.DatabaseURL)
+	defer repository.CloseDatabase()
+	jobs.StartExpirySweeper(cfg.ExpirySweepInterval.Duration)
+	jobs.StartTrashPurger(cfg.TrashPurgeInterval.Duration, cfg.TrashRetention.Duration)
+
+	var locator geoip.Locator = geoip.None{}
+	if cfg.GeoIPDatabase != "" {
+		database, err := geoip.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer database.Close()
+		locator = database
+	}
+	handlers.UseLocator(locator)
+
+	clickQueue := ingest.NewQueue(ingest.Config{
+		BufferSize:    cfg.ClickBufferSize,
+		BatchSize:     cfg.ClickBatchSize,
+		FlushInterval: cfg.ClickFlushInterval.Duration,
+		Workers:       cfg.ClickWorkers,
+		Locator:       locator,
+	}, ingest.DatabaseWriter)
+	clickQueue.Start()
+	handlers.UseClickQueue(clickQueue)
+
+	var store cache.Store = cache.NewMemoryStore(cfg.CacheSize)
+	if cfg.CacheBackend == config.CacheRedis {
+		redisStore, err := cache.NewRedisStore(cfg.RedisURL, "shortener:")
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		defer redisStore.Close()
+		store = redisStore
+	}
+	links := cache.NewLinks(store, cfg.CacheTTL.Duration, cfg.CacheNegativeTTL.Duration)
+	handlers.UseLinkCache(links)
+
+	// Destinations on the base host or a verified custom domain would redirect to another short link
+	checker := &safety.Checker{
+		Schemes: cfg.URLSchemes,
+		Hosts:   []string{cfg.BaseHost()},
+		IsOwnDomain: func(host string) (bool, error) {
+			domain, err := links.Domain(host)
+			return domain != nil, err
+		},
+		Reputation: safety.None{},
+	}
+	if cfg.URLBlocklist != "" {
+		blocklist, err := safety.LoadBlocklist(cfg.URLBlocklist)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		checker.Reputation = blocklist
+	}
+	handlers.UseURLChecker(checker)
+	jobs.StartURLRescan(cfg.URLRescanInterval.Duration, checker, links)
+
+	server := &http.Server{Addr: cfg.Port, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}()
+
+	// Stop taking requests on SIGINT or SIGTERM, then write the clicks that are still buffered
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+	fmt.Println("Shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Println("Error shutting down server:", err)
+	}
+	if err := clickQueue.Close(ctx); err != nil {
+		fmt.Println("Error draining click queue:", err)
+	}
 }
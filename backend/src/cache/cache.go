@@ -0,0 +1,15 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store is a key value cache with expiring entries. MemoryStore keeps entries in process,
+// RedisStore works with any Redis compatible server and is shared between instances
+type Store interface {
+	// Get returns the value and whether the key was found
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
@@ -0,0 +1,212 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"html/template"
+	"link-shortener-backend/src/metrics"
+	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/rules"
+	"strconv"
+	"time"
+)
+
+var (
+	hits     = metrics.NewCounter("cache_hits_total", "Lookups answered from the cache")
+	misses   = metrics.NewCounter("cache_misses_total", "Lookups that had to go to the database")
+	failures = metrics.NewCounter("cache_errors_total", "Cache operations that failed")
+)
+
+// Source loads values on a cache miss, RepositorySource reads them from the database
+type Source interface {
+	GetLinkByShortId(shortId string, domainID *int) (*repository.Link, error)
+	GetRedirectsByLinkID(linkID string) ([]repository.Redirect, error)
+	GetVerifiedDomainByHostname(hostname string) (*repository.Domain, error)
+	GetVariants(linkID int) ([]repository.Variant, error)
+	GetPageTemplate(userID string, page string) (*repository.PageTemplate, error)
+}
+
+type RepositorySource struct{}
+
+func (RepositorySource) GetLinkByShortId(shortId string, domainID *int) (*repository.Link, error) {
+	return repository.GetLinkByShortId(shortId, domainID)
+}
+
+func (RepositorySource) GetRedirectsByLinkID(linkID string) ([]repository.Redirect, error) {
+	return repository.GetRedirectsByLinkID(linkID)
+}
+
+func (RepositorySource) GetVerifiedDomainByHostname(hostname string) (*repository.Domain, error) {
+	return repository.GetVerifiedDomainByHostname(hostname)
+}
+
+func (RepositorySource) GetVariants(linkID int) ([]repository.Variant, error) {
+	return repository.GetVariants(linkID)
+}
+
+func (RepositorySource) GetPageTemplate(userID string, page string) (*repository.PageTemplate, error) {
+	return repository.GetPageTemplate(userID, page)
+}
+
+// Links caches the lookups made by every redirect and the custom pages shown for unavailable links.
+// Unknown short ids and hosts are cached as well, for NegativeTTL, so guessing ids does not reach the database every time.
+// Writes have to call the Invalidate methods, the click count of a cached link may lag up to TTL behind
+type Links struct {
+	Store       Store
+	Source      Source
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	compiled compiledCache[int, *rules.RuleSet]
+	pages    compiledCache[string, *template.Template]
+}
+
+func NewLinks(store Store, ttl time.Duration, negativeTTL time.Duration) *Links {
+	return &Links{Store: store, Source: RepositorySource{}, TTL: ttl, NegativeTTL: negativeTTL}
+}
+
+// entry wraps cached values, a nil Value is a cached miss
+type entry[T any] struct {
+	Value *T
+}
+
+// load reads the value from the store or fetches and stores it. Values rejected by cacheable are
+// always fetched, a nil cacheable accepts every value
+func load[T any](l *Links, key string, fetch func() (*T, error), cacheable func(*T) bool) (*T, error) {
+	ctx := context.Background()
+	data, found, err := l.Store.Get(ctx, key)
+	if err != nil {
+		failures.Inc()
+		fmt.Println("Error reading cache:", err)
+	}
+	if found {
+		var cached entry[T]
+		err := gob.NewDecoder(bytes.NewReader(data)).Decode(&cached)
+		if err == nil && (cacheable == nil || cached.Value == nil || cacheable(cached.Value)) {
+			hits.Inc()
+			return cached.Value, nil
+		}
+		if err != nil {
+			failures.Inc()
+		} else {
+			l.invalidate(key)
+		}
+	}
+	misses.Inc()
+
+	value, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	if value != nil && cacheable != nil && !cacheable(value) {
+		return value, nil
+	}
+	ttl := l.TTL
+	if value == nil {
+		ttl = l.NegativeTTL
+	}
+	var buffer bytes.Buffer
+	if err := gob.NewEncoder(&buffer).Encode(entry[T]{Value: value}); err != nil {
+		failures.Inc()
+		return value, nil
+	}
+	if err := l.Store.Set(ctx, key, buffer.Bytes(), ttl); err != nil {
+		failures.Inc()
+		fmt.Println("Error writing cache:", err)
+	}
+	return value, nil
+}
+
+func (l *Links) invalidate(keys ...string) {
+	if err := l.Store.Delete(context.Background(), keys...); err != nil {
+		failures.Inc()
+		fmt.Println("Error invalidating cache:", err)
+	}
+}
+
+func linkKey(shortId string, domainID *int) string {
+	domain := 0
+	if domainID != nil {
+		domain = *domainID
+	}
+	return "link:" + strconv.Itoa(domain) + ":" + shortId
+}
+
+func redirectsKey(linkID int) string {
+	return "redirects:" + strconv.Itoa(linkID)
+}
+
+func variantsKey(linkID int) string {
+	return "variants:" + strconv.Itoa(linkID)
+}
+
+func domainKey(hostname string) string {
+	return "domain:" + hostname
+}
+
+// Link gets the link with the short id on the domain, nil when there is none
+func (l *Links) Link(shortId string, domainID *int) (*repository.Link, error) {
+	return load(l, linkKey(shortId, domainID), func() (*repository.Link, error) {
+		return l.Source.GetLinkByShortId(shortId, domainID)
+	}, clickCountStable)
+}
+
+// clickCountStable reports whether the link can be served from the cache. A cached click count can be
+// up to the TTL old, links with a click budget are read from the database so they stop at the limit
+func clickCountStable(link *repository.Link) bool {
+	return link.MaxClicks == nil
+}
+
+// Redirects gets the redirect rules of the link
+func (l *Links) Redirects(linkID int) ([]repository.Redirect, error) {
+	redirects, err := load(l, redirectsKey(linkID), func() (*[]repository.Redirect, error) {
+		redirects, err := l.Source.GetRedirectsByLinkID(strconv.Itoa(linkID))
+		return &redirects, err
+	}, nil)
+	if err != nil || redirects == nil {
+		return nil, err
+	}
+	return *redirects, nil
+}
+
+// Variants gets the destinations a link rotates its traffic across
+func (l *Links) Variants(linkID int) ([]repository.Variant, error) {
+	variants, err := load(l, variantsKey(linkID), func() (*[]repository.Variant, error) {
+		variants, err := l.Source.GetVariants(linkID)
+		return &variants, err
+	}, nil)
+	if err != nil || variants == nil {
+		return nil, err
+	}
+	return *variants, nil
+}
+
+// Domain gets the verified custom domain with the hostname, nil when the host is not a custom domain
+func (l *Links) Domain(hostname string) (*repository.Domain, error) {
+	return load(l, domainKey(hostname), func() (*repository.Domain, error) {
+		return l.Source.GetVerifiedDomainByHostname(hostname)
+	}, nil)
+}
+
+// InvalidateLink drops the cached link, call it for the old and new short id when the short id changes
+func (l *Links) InvalidateLink(shortId string, domainID *int) {
+	l.invalidate(linkKey(shortId, domainID))
+}
+
+// InvalidateRedirects drops the cached redirect rules of the link
+func (l *Links) InvalidateRedirects(linkID int) {
+	l.compiled.delete(linkID)
+	l.invalidate(redirectsKey(linkID))
+}
+
+// InvalidateVariants drops the cached variants of the link
+func (l *Links) InvalidateVariants(linkID int) {
+	l.invalidate(variantsKey(linkID))
+}
+
+// InvalidateDomain drops the cached domain
+func (l *Links) InvalidateDomain(hostname string) {
+	l.invalidate(domainKey(hostname))
+}
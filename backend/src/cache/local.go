@@ -0,0 +1,58 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// maxCompiled is the most compiled values kept in process per kind
+const maxCompiled = 10000
+
+// compiledCache keeps values compiled from cached data in process, they can not be stored in a shared Store.
+// An instance that did not handle the write keeps using its compiled value for up to TTL
+type compiledCache[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]compiledEntry[V]
+}
+
+type compiledEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+func (c *compiledCache[K, V]) get(key K, now time.Time) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+func (c *compiledCache[K, V]) set(key K, value V, now time.Time, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[K]compiledEntry[V])
+	}
+	if len(c.entries) >= maxCompiled {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		// Nothing expired, start over instead of tracking recency like MemoryStore
+		if len(c.entries) >= maxCompiled {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = compiledEntry[V]{value: value, expiresAt: expiresAt}
+}
+
+func (c *compiledCache[K, V]) delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"fmt"
+	"html/template"
+	"link-shortener-backend/src/pages"
+	"link-shortener-backend/src/repository"
+	"time"
+)
+
+func pageKey(userID string, page string) string {
+	return "page:" + userID + ":" + page
+}
+
+// Page gets the parsed custom template the user uploaded for the page, nil when there is none or it
+// does not parse. The page is the name owners use, like not_found
+func (l *Links) Page(userID string, page string) (*template.Template, error) {
+	key := pageKey(userID, page)
+	now := time.Now()
+	if custom, ok := l.pages.get(key, now); ok {
+		return custom, nil
+	}
+	pageTemplate, err := load(l, key, func() (*repository.PageTemplate, error) {
+		return l.Source.GetPageTemplate(userID, page)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	var custom *template.Template
+	if pageTemplate != nil {
+		custom, err = pages.ParseCustom(pageTemplate.Body)
+		if err != nil {
+			// Templates are checked when they are saved, the built in page is shown for one that stopped parsing
+			fmt.Println("Error parsing page template:", err)
+			custom = nil
+		}
+	}
+	l.pages.set(key, custom, now, now.Add(l.TTL))
+	return custom, nil
+}
+
+// InvalidatePage drops the cached custom template of the user for the page
+func (l *Links) InvalidatePage(userID string, page string) {
+	key := pageKey(userID, page)
+	l.pages.delete(key)
+	l.invalidate(key)
+}
@@ -0,0 +1,21 @@
+package cache
+
+import (
+	"link-shortener-backend/src/rules"
+	"time"
+)
+
+// Rules gets the compiled redirect rules of the link
+func (l *Links) Rules(linkID int) (*rules.RuleSet, error) {
+	now := time.Now()
+	if set, ok := l.compiled.get(linkID, now); ok {
+		return set, nil
+	}
+	redirects, err := l.Redirects(linkID)
+	if err != nil {
+		return nil, err
+	}
+	set := rules.Compile(redirects)
+	l.compiled.set(linkID, set, now, now.Add(l.TTL))
+	return set, nil
+}
@@ -0,0 +1,365 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"link-shortener-backend/src/quota"
+	"link-shortener-backend/src/shortid"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Config holds the server settings. Values are read from the defaults, then a JSON config file,
+// then environment variables (including a .env file) and finally command line flags, later sources win
+type Config struct {
+	// Port is the address the server listens on, e.g. ":8080"
+	Port string `json:"port"`
+	// BaseURL is the public url short links on the default domain start with
+	BaseURL string `json:"baseUrl"`
+	// FrontendURL is where the dashboard is served, used for the Stripe checkout redirects
+	FrontendURL  string `json:"frontendUrl"`
+	CookieDomain string `json:"cookieDomain"`
+	CookieSecure bool   `json:"cookieSecure"`
+	DatabaseURL  string `json:"databaseUrl"`
+	JWTSecret    string `json:"jwtSecret"`
+
+	StripeSecretKey     string `json:"stripeSecretKey"`
+	StripeWebhookSecret string `json:"stripeWebhookSecret"`
+
+	ShortIdStrategy    string `json:"shortIdStrategy"`
+	ShortIdSalt        string `json:"shortIdSalt"`
+	ShortIdMinLength   int    `json:"shortIdMinLength"`
+	ClickOveragePolicy string `json:"clickOveragePolicy"`
+
+	ExpirySweepInterval Duration `json:"expirySweepInterval"`
+	// Deleted links can be restored for TrashRetention, the purge job removes them for good afterwards
+	TrashRetention     Duration `json:"trashRetention"`
+	TrashPurgeInterval Duration `json:"trashPurgeInterval"`
+
+	// Clicks are written in batches of ClickBatchSize or every ClickFlushInterval, whichever comes first
+	ClickBufferSize    int      `json:"clickBufferSize"`
+	ClickBatchSize     int      `json:"clickBatchSize"`
+	ClickFlushInterval Duration `json:"clickFlushInterval"`
+	ClickWorkers       int      `json:"clickWorkers"`
+	// ShutdownTimeout is how long open requests and buffered clicks get to finish on shutdown
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+
+	// GeoIPDatabase is the path of a MaxMind format (mmdb) database, clicks have no location and
+	// country rules never match without it
+	GeoIPDatabase string `json:"geoipDatabase"`
+
+	// CacheBackend is "memory" for a per process cache or "redis" to share it between instances
+	CacheBackend string `json:"cacheBackend"`
+	RedisURL     string `json:"redisUrl"`
+	// CacheSize is the number of entries the memory cache keeps
+	CacheSize int      `json:"cacheSize"`
+	CacheTTL  Duration `json:"cacheTtl"`
+	// CacheNegativeTTL is how long unknown short ids and hosts are remembered
+	CacheNegativeTTL Duration `json:"cacheNegativeTtl"`
+
+	// URLSchemes are the schemes link destinations may use
+	URLSchemes []string `json:"urlSchemes"`
+	// URLBlocklist is the path of a file of blocked hosts and url prefixes, see safety.Blocklist
+	URLBlocklist string `json:"urlBlocklist"`
+	// URLRescanInterval is how often existing destinations are checked again, links that fail are disabled
+	URLRescanInterval Duration `json:"urlRescanInterval"`
+}
+
+const (
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+// Duration reads durations like "1m" from the config file
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// Default returns the settings used for local development
+func Default() *Config {
+	return &Config{
+		Port:                ":8080",
+		BaseURL:             "http://localhost:8080/",
+		FrontendURL:         "http://localhost:3000",
+		CookieSecure:        true,
+		ShortIdStrategy:     shortid.StrategyRandom,
+		ShortIdMinLength:    6,
+		ClickOveragePolicy:  string(quota.PolicyUntracked),
+		ExpirySweepInterval: Duration{time.Minute},
+		TrashRetention:      Duration{30 * 24 * time.Hour},
+		TrashPurgeInterval:  Duration{time.Hour},
+		ClickBufferSize:     10000,
+		ClickBatchSize:      500,
+		ClickFlushInterval:  Duration{500 * time.Millisecond},
+		ClickWorkers:        2,
+		ShutdownTimeout:     Duration{15 * time.Second},
+		CacheBackend:        CacheMemory,
+		CacheSize:           10000,
+		CacheTTL:            Duration{30 * time.Second},
+		CacheNegativeTTL:    Duration{5 * time.Second},
+		URLSchemes:          []string{"http", "https"},
+		URLRescanInterval:   Duration{24 * time.Hour},
+	}
+}
+
+// Load reads the config from all sources and validates it. args are the command line arguments without the program name
+func Load(args []string) (*Config, error) {
+	flags := flag.NewFlagSet("link-shortener", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "path to a JSON config file")
+	port := flags.String("port", "", "address to listen on, e.g. :8080")
+	baseURL := flags.String("base-url", "", "public base url of short links")
+	frontendURL := flags.String("frontend-url", "", "url of the dashboard")
+	cookieDomain := flags.String("cookie-domain", "", "domain of the session cookie")
+	databaseURL := flags.String("database-url", "", "postgres connection url")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// The .env file is optional, deployments usually set the variables directly
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Port = *port
+		case "base-url":
+			cfg.BaseURL = *baseURL
+		case "frontend-url":
+			cfg.FrontendURL = *frontendURL
+		case "cookie-domain":
+			cfg.CookieDomain = *cookieDomain
+		case "database-url":
+			cfg.DatabaseURL = *databaseURL
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (cfg *Config) loadEnv() error {
+	values := map[string]*string{
+		"PORT":                  &cfg.Port,
+		"BASE_URL":              &cfg.BaseURL,
+		"FRONTEND_URL":          &cfg.FrontendURL,
+		"COOKIE_DOMAIN":         &cfg.CookieDomain,
+		"DATABASE_URL":          &cfg.DatabaseURL,
+		"JWT_SECRET_KEY":        &cfg.JWTSecret,
+		"STRIPE_SECRET_KEY":     &cfg.StripeSecretKey,
+		"STRIPE_WEBHOOK_SECRET": &cfg.StripeWebhookSecret,
+		"SHORT_ID_STRATEGY":     &cfg.ShortIdStrategy,
+		"SHORT_ID_SALT":         &cfg.ShortIdSalt,
+		"CLICK_OVERAGE_POLICY":  &cfg.ClickOveragePolicy,
+		"CACHE_BACKEND":         &cfg.CacheBackend,
+		"REDIS_URL":             &cfg.RedisURL,
+		"GEOIP_DATABASE":        &cfg.GeoIPDatabase,
+		"URL_BLOCKLIST":         &cfg.URLBlocklist,
+	}
+	// JWT_SECRET was used for validating sessions before the settings were unified
+	if env, ok := os.LookupEnv("JWT_SECRET"); ok {
+		cfg.JWTSecret = env
+	}
+	for name, value := range values {
+		if env, ok := os.LookupEnv(name); ok {
+			*value = env
+		}
+	}
+
+	if env, ok := os.LookupEnv("COOKIE_SECURE"); ok {
+		secure, err := strconv.ParseBool(env)
+		if err != nil {
+			return fmt.Errorf("COOKIE_SECURE: %w", err)
+		}
+		cfg.CookieSecure = secure
+	}
+	// URL_SCHEMES is a comma separated list like "http,https"
+	if env, ok := os.LookupEnv("URL_SCHEMES"); ok {
+		cfg.URLSchemes = nil
+		for _, scheme := range strings.Split(env, ",") {
+			if scheme = strings.TrimSpace(scheme); scheme != "" {
+				cfg.URLSchemes = append(cfg.URLSchemes, scheme)
+			}
+		}
+	}
+	ints := map[string]*int{
+		"SHORT_ID_MIN_LENGTH": &cfg.ShortIdMinLength,
+		"CLICK_BUFFER_SIZE":   &cfg.ClickBufferSize,
+		"CLICK_BATCH_SIZE":    &cfg.ClickBatchSize,
+		"CLICK_WORKERS":       &cfg.ClickWorkers,
+		"CACHE_SIZE":          &cfg.CacheSize,
+	}
+	for name, value := range ints {
+		if env, ok := os.LookupEnv(name); ok {
+			parsed, err := strconv.Atoi(env)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			*value = parsed
+		}
+	}
+	durations := map[string]*Duration{
+		"EXPIRY_SWEEP_INTERVAL": &cfg.ExpirySweepInterval,
+		"TRASH_RETENTION":       &cfg.TrashRetention,
+		"TRASH_PURGE_INTERVAL":  &cfg.TrashPurgeInterval,
+		"CLICK_FLUSH_INTERVAL":  &cfg.ClickFlushInterval,
+		"SHUTDOWN_TIMEOUT":      &cfg.ShutdownTimeout,
+		"CACHE_TTL":             &cfg.CacheTTL,
+		"CACHE_NEGATIVE_TTL":    &cfg.CacheNegativeTTL,
+		"URL_RESCAN_INTERVAL":   &cfg.URLRescanInterval,
+	}
+	for name, value := range durations {
+		if env, ok := os.LookupEnv(name); ok {
+			parsed, err := time.ParseDuration(env)
+			if err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			value.Duration = parsed
+		}
+	}
+	return nil
+}
+
+// Validate checks the settings and normalizes the urls
+func (cfg *Config) Validate() error {
+	var problems []string
+	if cfg.Port == "" {
+		problems = append(problems, "port is required")
+	}
+	if err := validateURL(cfg.BaseURL); err != nil {
+		problems = append(problems, "base url "+err.Error())
+	} else if !strings.HasSuffix(cfg.BaseURL, "/") {
+		cfg.BaseURL += "/"
+	}
+	if err := validateURL(cfg.FrontendURL); err != nil {
+		problems = append(problems, "frontend url "+err.Error())
+	} else {
+		cfg.FrontendURL = strings.TrimSuffix(cfg.FrontendURL, "/")
+	}
+	if cfg.DatabaseURL == "" {
+		problems = append(problems, "database url is required")
+	}
+	if cfg.JWTSecret == "" {
+		problems = append(problems, "jwt secret is required")
+	}
+	if _, err := shortid.New(cfg.ShortIdStrategy, cfg.ShortIdSalt, cfg.ShortIdMinLength); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.ShortIdMinLength < 1 {
+		problems = append(problems, "short id min length must be at least 1")
+	}
+	if _, err := quota.ParsePolicy(cfg.ClickOveragePolicy); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.ExpirySweepInterval.Duration <= 0 {
+		problems = append(problems, "expiry sweep interval must be positive")
+	}
+	if cfg.TrashRetention.Duration <= 0 || cfg.TrashPurgeInterval.Duration <= 0 {
+		problems = append(problems, "trash retention and purge interval must be positive")
+	}
+	if cfg.ClickBufferSize < 1 || cfg.ClickBatchSize < 1 || cfg.ClickWorkers < 1 {
+		problems = append(problems, "click buffer size, batch size and workers must be at least 1")
+	}
+	if cfg.ClickFlushInterval.Duration <= 0 {
+		problems = append(problems, "click flush interval must be positive")
+	}
+	if cfg.ShutdownTimeout.Duration <= 0 {
+		problems = append(problems, "shutdown timeout must be positive")
+	}
+	switch cfg.CacheBackend {
+	case CacheMemory:
+		if cfg.CacheSize < 1 {
+			problems = append(problems, "cache size must be at least 1")
+		}
+	case CacheRedis:
+		if cfg.RedisURL == "" {
+			problems = append(problems, "redis url is required for the redis cache")
+		}
+	default:
+		problems = append(problems, "cache backend must be memory or redis")
+	}
+	if cfg.CacheTTL.Duration <= 0 || cfg.CacheNegativeTTL.Duration <= 0 {
+		problems = append(problems, "cache ttls must be positive")
+	}
+	if len(cfg.URLSchemes) == 0 {
+		problems = append(problems, "at least one url scheme must be allowed")
+	}
+	for i, scheme := range cfg.URLSchemes {
+		scheme = strings.ToLower(strings.TrimSpace(scheme))
+		cfg.URLSchemes[i] = scheme
+		if scheme == "javascript" || scheme == "data" || scheme == "vbscript" || scheme == "file" {
+			problems = append(problems, "url scheme "+scheme+" can not be allowed")
+		}
+	}
+	if cfg.URLRescanInterval.Duration <= 0 {
+		problems = append(problems, "url rescan interval must be positive")
+	}
+	if len(problems) > 0 {
+		return errors.New("invalid config: " + strings.Join(problems, ", "))
+	}
+	return nil
+}
+
+// BaseHost is the hostname of the base url
+func (cfg *Config) BaseHost() string {
+	parsed, err := url.Parse(cfg.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return parsed.Hostname()
+}
+
+func validateURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("must be an absolute http or https url")
+	}
+	return nil
+}
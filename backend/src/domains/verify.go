@@ -0,0 +1,84 @@
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+)
+
+// recordPrefix is the label the TXT record proving ownership of a domain is published under
+const recordPrefix = "_shortener-verify."
+
+// valuePrefix starts the value of the TXT record
+const valuePrefix = "shortener-verify="
+
+var ErrInvalidHostname = errors.New("invalid hostname")
+
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// Resolver looks up DNS TXT records, net.Resolver implements it and tests can stub it
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Verifier checks domain ownership through a TXT record
+type Verifier struct {
+	Resolver Resolver
+}
+
+func NewVerifier(resolver Resolver) *Verifier {
+	return &Verifier{Resolver: resolver}
+}
+
+// DefaultVerifier uses the system DNS resolver
+var DefaultVerifier = NewVerifier(net.DefaultResolver)
+
+// NormalizeHostname lowercases the hostname, strips a trailing dot and checks that it is a valid domain name
+func NormalizeHostname(hostname string) (string, error) {
+	hostname = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(hostname)), ".")
+	if len(hostname) > 253 || !hostnamePattern.MatchString(hostname) {
+		return "", ErrInvalidHostname
+	}
+	return hostname, nil
+}
+
+// NewToken returns a random verification token
+func NewToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// RecordName is the name of the TXT record the owner has to create
+func RecordName(hostname string) string {
+	return recordPrefix + hostname
+}
+
+// RecordValue is the value of the TXT record the owner has to create
+func RecordValue(token string) string {
+	return valuePrefix + token
+}
+
+// Verify reports whether the TXT record for the hostname contains the token
+func (v *Verifier) Verify(ctx context.Context, hostname string, token string) (bool, error) {
+	records, err := v.Resolver.LookupTXT(ctx, RecordName(hostname))
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == RecordValue(token) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
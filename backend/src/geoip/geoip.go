@@ -0,0 +1,92 @@
+package geoip
+
+import (
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is where an ip address is registered. Country is the ISO 3166-1 alpha-2 code,
+// fields are empty when the database does not know them
+type Location struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+	City    string `json:"city"`
+}
+
+// Locator looks up the location of ip addresses
+type Locator interface {
+	Lookup(ip string) (Location, error)
+}
+
+// None is used when no database is configured, it never knows the location
+type None struct{}
+
+func (None) Lookup(ip string) (Location, error) {
+	return Location{}, nil
+}
+
+// Database reads a MaxMind format (mmdb) file, like GeoLite2-City or GeoLite2-Country.
+// Region and city are only available in city databases
+type Database struct {
+	reader *maxminddb.Reader
+}
+
+// record is the part of the GeoIP2 city and country layout that is decoded
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+// Open memory maps the database file at path
+func Open(path string) (*Database, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{reader: reader}, nil
+}
+
+// FromBytes reads a database that is already in memory, e.g. an embedded fixture
+func FromBytes(data []byte) (*Database, error) {
+	reader, err := maxminddb.FromBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Database{reader: reader}, nil
+}
+
+// Lookup returns the location of the ip, an empty location when the ip is invalid or unknown
+func (d *Database) Lookup(ip string) (Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return Location{}, nil
+	}
+	var result record
+	if err := d.reader.Lookup(parsed, &result); err != nil {
+		return Location{}, err
+	}
+	location := Location{
+		Country: result.Country.ISOCode,
+		City:    result.City.Names["en"],
+	}
+	if len(result.Subdivisions) > 0 {
+		location.Region = result.Subdivisions[0].Names["en"]
+		if location.Region == "" {
+			location.Region = result.Subdivisions[0].ISOCode
+		}
+	}
+	return location, nil
+}
+
+func (d *Database) Close() error {
+	return d.reader.Close()
+}
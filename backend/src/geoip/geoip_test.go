@@ -0,0 +1,55 @@
+package geoip
+
+import (
+	"os"
+	"testing"
+)
+
+// testdata/city.mmdb is a GeoIP2-City layout database with three networks:
+// 203.0.113.0/24 in Berlin, DE, 198.51.100.0/24 in FR with a subdivision that only has a code,
+// and 2001:db8::/32 in US without region or city
+func openFixture(t *testing.T) *Database {
+	t.Helper()
+	data, err := os.ReadFile("testdata/city.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.Close() })
+	return database
+}
+
+func TestDatabaseLookup(t *testing.T) {
+	database := openFixture(t)
+	tests := []struct {
+		ip       string
+		location Location
+	}{
+		{"203.0.113.7", Location{Country: "DE", Region: "Berlin", City: "Berlin"}},
+		{"198.51.100.1", Location{Country: "FR", Region: "IDF"}},
+		{"2001:db8::1", Location{Country: "US"}},
+		{"192.0.2.1", Location{}},
+		{"not an ip", Location{}},
+		{"", Location{}},
+	}
+	for _, test := range tests {
+		t.Run(test.ip, func(t *testing.T) {
+			location, err := database.Lookup(test.ip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if location != test.location {
+				t.Errorf("location = %+v, want %+v", location, test.location)
+			}
+		})
+	}
+}
+
+func TestFromBytesInvalid(t *testing.T) {
+	if _, err := FromBytes([]byte("not a database")); err == nil {
+		t.Error("invalid database was accepted")
+	}
+}
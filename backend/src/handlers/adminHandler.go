@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxAdminPage is the most reports or audit entries returned at once
+	maxAdminPage = 100
+)
+
+// ModerationRequest carries the note an admin records with an action
+type ModerationRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ResolveReportRequest is the action taken on a report and the decision recorded with it
+type ResolveReportRequest struct {
+	Action   repository.ReportAction `json:"action"`
+	Decision string                  `json:"decision"`
+}
+
+// GetAbuseReports gets the queue of reports with the status given in the query, open reports by default
+func GetAbuseReports(c *gin.Context) {
+	status := repository.ReportStatus(c.DefaultQuery("status", string(repository.ReportOpen)))
+	if status != repository.ReportOpen && status != repository.ReportActioned && status != repository.ReportDismissed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be open, actioned or dismissed"})
+		return
+	}
+	reports, err := repository.GetAbuseReports(status, maxAdminPage)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
+
+// ResolveAbuseReport dismisses a report, or disables the reported link or suspends its owner
+func ResolveAbuseReport(c *gin.Context) {
+	admin := c.MustGet("user").(*repository.User)
+	var request ResolveReportRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch request.Action {
+	case repository.ReportDismiss, repository.ReportDisableLink, repository.ReportSuspendUser:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be dismiss, disable_link or suspend_user"})
+		return
+	}
+	decision, ok := moderationNote(c, request.Decision)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report id"})
+		return
+	}
+
+	report, links, err := repository.ResolveAbuseReport(id, request.Action, decision, admin.ID)
+	if err == repository.ErrReportNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err == repository.ErrReportResolved {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	invalidateModeratedLinks(links)
+	c.JSON(http.StatusOK, report)
+}
+
+// AdminDisableLink blocks a link, visitors get the blocked page with status 451
+func AdminDisableLink(c *gin.Context) {
+	setLinkDisabled(c, true)
+}
+
+// AdminEnableLink makes a disabled link redirect again
+func AdminEnableLink(c *gin.Context) {
+	setLinkDisabled(c, false)
+}
+
+func setLinkDisabled(c *gin.Context, disabled bool) {
+	admin := c.MustGet("user").(*repository.User)
+	var request ModerationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason, ok := moderationNote(c, request.Reason)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid link id"})
+		return
+	}
+	link, err := repository.SetLinkDisabled(id, disabled, reason, admin.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Link not found or already in that state"})
+		return
+	}
+	invalidateModeratedLinks([]repository.ModeratedLink{*link})
+	c.JSON(http.StatusOK, gin.H{"message": "Link updated"})
+}
+
+// AdminSuspendUser suspends a user and disables all of their links
+func AdminSuspendUser(c *gin.Context) {
+	setUserSuspended(c, true)
+}
+
+// AdminReinstateUser lifts the suspension of a user, their links stay disabled until enabled one by one
+func AdminReinstateUser(c *gin.Context) {
+	setUserSuspended(c, false)
+}
+
+func setUserSuspended(c *gin.Context, suspended bool) {
+	admin := c.MustGet("user").(*repository.User)
+	var request ModerationRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reason, ok := moderationNote(c, request.Reason)
+	if !ok {
+		return
+	}
+	parsed, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user id"})
+		return
+	}
+	// The canonical form is compared with the id of the admin
+	userID := parsed.String()
+	if suspended && userID == admin.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can not suspend yourself"})
+		return
+	}
+	changed, links, err := repository.SetUserSuspended(userID, suspended, reason, admin.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !changed {
+		c.JSON(http.StatusConflict, gin.H{"error": "User not found or already in that state"})
+		return
+	}
+	invalidateModeratedLinks(links)
+	c.JSON(http.StatusOK, gin.H{"message": "User updated", "disabledLinks": len(links)})
+}
+
+// GetAuditLog gets the moderation audit log, newest first. The query may narrow it to a target with
+// targetType and targetId and page with before, an RFC 3339 time
+func GetAuditLog(c *gin.Context) {
+	targetType := repository.AuditTarget(c.Query("targetType"))
+	targetID := c.Query("targetId")
+	if targetType != "" && targetType != repository.AuditTargetLink && targetType != repository.AuditTargetUser && targetType != repository.AuditTargetReport {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Target type must be link, user or report"})
+		return
+	}
+	before := time.Now()
+	if value := c.Query("before"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Before must be an RFC 3339 time"})
+			return
+		}
+		before = parsed
+	}
+	entries, err := repository.GetAuditLog(targetType, targetID, before, maxAdminPage)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, entries)
+}
+
+// moderationNote checks the reason or decision of an admin action, it is required so the audit log
+// explains every action. It writes the error response and returns false when the note is missing
+func moderationNote(c *gin.Context, note string) (string, bool) {
+	note = strings.TrimSpace(note)
+	if note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason for the decision is required"})
+		return "", false
+	}
+	return note, true
+}
+
+// invalidateModeratedLinks drops the cached links, so the new status applies to the next visit
+func invalidateModeratedLinks(links []repository.ModeratedLink) {
+	for _, link := range links {
+		linkCache.InvalidateLink(link.ShortId, link.DomainID)
+	}
+}
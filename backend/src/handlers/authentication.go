@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"link-shortener-backend/src/repository"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -13,6 +12,12 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountSuspended is returned for sessions of users an admin suspended
+var ErrAccountSuspended = errors.New("account suspended")
+
+// linkUnlockDuration is how long a visitor stays unlocked after entering a link password
+const linkUnlockDuration = time.Hour
+
 type LoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -32,6 +37,11 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 		user, err := ValidateSession(sessionToken)
+		if err == ErrAccountSuspended {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been suspended"})
+			c.Abort()
+			return
+		}
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
@@ -42,6 +52,19 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// AdminMiddleware only lets admins through, it has to run after AuthMiddleware
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := c.MustGet("user").(*repository.User)
+		if !user.IsAdmin() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admins only"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func Register(c *gin.Context) {
 	var request RegisterRequest
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -94,7 +117,6 @@ func HashPassword(password string) (string, error) {
 }
 
 func VerifyPassword(hashedPassword, password string) bool {
-	fmt.Println(hashedPassword, password)
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
 }
@@ -105,7 +127,7 @@ func GenerateJWT(userID string) (string, error) {
 		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expires in 24 hours
 	})
 
-	secretKey := []byte(os.Getenv("JWT_SECRET_KEY"))
+	secretKey := []byte(settings.JWTSecret)
 	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
 		return "", err
@@ -114,14 +136,37 @@ func GenerateJWT(userID string) (string, error) {
 	return tokenString, nil
 }
 
+// GenerateLinkUnlockToken signs a short lived token proving the visitor entered the password of a link
+func GenerateLinkUnlockToken(linkID int) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"link_id": linkID,
+		"exp":     time.Now().Add(linkUnlockDuration).Unix(),
+	})
+
+	return token.SignedString([]byte(settings.JWTSecret))
+}
+
+// ValidateLinkUnlockToken checks that the token was issued for the given link and has not expired
+func ValidateLinkUnlockToken(tokenString string, linkID int) bool {
+	claims := &jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(settings.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil || !token.Valid {
+		return false
+	}
+	tokenLinkID, ok := (*claims)["link_id"].(float64)
+	return ok && int(tokenLinkID) == linkID
+}
+
 func SetSessionCookie(c *gin.Context, token string) {
 	c.SetCookie(
 		"session_token",
 		token,
 		3600*24, // Max age in seconds (24 hours)
 		"/",
-		"",
-		true, // Secure
+		settings.CookieDomain,
+		settings.CookieSecure,
 		true, // HttpOnly
 	)
 }
@@ -145,6 +190,10 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account has been suspended"})
+		return
+	}
 
 	token, err := GenerateJWT(user.ID)
 	if err != nil {
@@ -163,8 +212,8 @@ func Logout(c *gin.Context) {
 		"",
 		-1,
 		"/",
-		"",
-		true,
+		settings.CookieDomain,
+		settings.CookieSecure,
 		true,
 	)
 	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
@@ -173,7 +222,7 @@ func Logout(c *gin.Context) {
 func ValidateSession(sessionToken string) (*repository.User, error) {
 	claims := &jwt.MapClaims{}
 	token, err := jwt.ParseWithClaims(sessionToken, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(os.Getenv("JWT_SECRET")), nil
+		return []byte(settings.JWTSecret), nil
 	})
 	if err != nil || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -188,6 +237,9 @@ func ValidateSession(sessionToken string) (*repository.User, error) {
 	if err != nil || user == nil {
 		return nil, errors.New("user not found")
 	}
+	if user.SuspendedAt != nil {
+		return nil, ErrAccountSuspended
+	}
 
 	return user, nil
 }
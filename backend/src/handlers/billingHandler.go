@@ -2,40 +2,35 @@ package handlers
 
 import (
 	"fmt"
+	"link-shortener-backend/src/quota"
 	"link-shortener-backend/src/repository"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GetBilling returns the subscription of the user, the package that applies to them and their usage against its limits
 func GetBilling(c *gin.Context) {
 	user := c.MustGet("user").(*repository.User)
 
-	// Function to return empty billing
-	emptyBilling := func() {
-		c.JSON(http.StatusOK, repository.Billing{
-			Package:      nil,
-			Subscription: nil,
-		})
+	var subscription *repository.Subscription
+	if user.StripeCustomerID != nil {
+		var err error
+		subscription, err = repository.GetSubscriptionByCustomerId(*user.StripeCustomerID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
-	if user.StripeCustomerID == nil {
-		emptyBilling()
-		return
-	}
-
-	subscription, err := repository.GetSubscriptionByCustomerId(*user.StripeCustomerID)
+	// The package and limits are resolved from the subscription above so they agree with it
+	subPackage, err := quota.SubscriptionPackage(subscription)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if subscription == nil {
-		emptyBilling()
-		return
-	}
-
-	subPackage, err := repository.GetPackageById(subscription.PackageID)
+	usage, err := quota.UsageFor(user.ID, subPackage)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -44,6 +39,7 @@ func GetBilling(c *gin.Context) {
 	c.JSON(http.StatusOK, repository.Billing{
 		Package:      subPackage,
 		Subscription: subscription,
+		Usage:        usage,
 	})
 }
 
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"link-shortener-backend/src/quota"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBulkLinks is the most links a single bulk request may create
+const maxBulkLinks = 1000
+
+// BulkLinkRow is a single link of a bulk request
+type BulkLinkRow struct {
+	Original string   `json:"original"`
+	Alias    string   `json:"alias"`
+	Tags     []string `json:"tags"`
+}
+
+// BulkLinkResult reports the outcome of a single row, rows are numbered from 1
+type BulkLinkResult struct {
+	Row   int              `json:"row"`
+	Link  *repository.Link `json:"link,omitempty"`
+	Error string           `json:"error,omitempty"`
+}
+
+type BulkLinkResponse struct {
+	Created int              `json:"created"`
+	Failed  int              `json:"failed"`
+	Results []BulkLinkResult `json:"results"`
+}
+
+// CreateLinksBulk creates many links at once from a JSON array or a CSV upload.
+// The CSV needs a header row with an original column and optional alias and tags columns, tags are separated by |
+func CreateLinksBulk(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	rows, err := readBulkRows(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No links given"})
+		return
+	}
+	if len(rows) > maxBulkLinks {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("At most %d links can be created at once", maxBulkLinks)})
+		return
+	}
+
+	maxLinks, err := quota.LinkLimit(user)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Rows that fail validation are reported without reaching the database, the rows that go over
+	// the package limit are reported by CreateLinks
+	results := make([]BulkLinkResult, len(rows))
+	var links []repository.Link
+	var linkRows []int
+	for i, row := range rows {
+		results[i].Row = i + 1
+		if err := validateBulkRow(row); err != nil {
+			results[i].Error = err.Error()
+			continue
+		}
+		links = append(links, repository.Link{
+			Original:  row.Original,
+			ShortId:   row.Alias,
+			CreatedAt: time.Now(),
+			CreatedBy: user.ID,
+			Tags:      row.Tags,
+		})
+		linkRows = append(linkRows, i)
+	}
+
+	if len(links) > 0 {
+		created, errs, err := repository.CreateLinks(links, settings.BaseURL, maxLinks)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		for i, row := range linkRows {
+			switch {
+			case errs[i] == repository.ErrShortIdTaken:
+				results[row].Error = ErrAliasTaken.Error()
+			case errs[i] == quota.ErrLinkLimitReached:
+				results[row].Error = errs[i].Error()
+			case errs[i] != nil:
+				fmt.Println(errs[i])
+				results[row].Error = errs[i].Error()
+			default:
+				results[row].Link = &created[i]
+				linkCache.InvalidateLink(created[i].ShortId, created[i].DomainID)
+			}
+		}
+	}
+
+	response := BulkLinkResponse{Results: results}
+	for _, result := range results {
+		if result.Error != "" {
+			response.Failed++
+		} else {
+			response.Created++
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func validateBulkRow(row BulkLinkRow) error {
+	if row.Original == "" {
+		return errors.New("destination is required")
+	}
+	if err := urlChecker.Check(row.Original); err != nil {
+		return err
+	}
+	if row.Alias != "" {
+		return ValidateAlias(row.Alias)
+	}
+	return nil
+}
+
+// readBulkRows reads the rows from a multipart CSV upload in the file field, a text/csv body or a JSON array
+func readBulkRows(c *gin.Context) ([]BulkLinkRow, error) {
+	contentType := c.ContentType()
+	switch {
+	case strings.HasPrefix(contentType, "multipart/form-data"):
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseBulkCSV(file)
+	case contentType == "text/csv":
+		return parseBulkCSV(c.Request.Body)
+	}
+	var rows []BulkLinkRow
+	if err := c.ShouldBindJSON(&rows); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func parseBulkCSV(reader io.Reader) ([]BulkLinkRow, error) {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	header, err := csvReader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["original"]; !ok {
+		return nil, errors.New("CSV header must contain an original column")
+	}
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []BulkLinkRow
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := BulkLinkRow{
+			Original: field(record, "original"),
+			Alias:    field(record, "alias"),
+		}
+		for _, tag := range strings.Split(field(record, "tags"), "|") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				row.Tags = append(row.Tags, tag)
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > maxBulkLinks {
+			break
+		}
+	}
+	return rows, nil
+}
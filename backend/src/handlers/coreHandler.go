@@ -2,11 +2,12 @@ package handlers
 
 import (
 	"fmt"
+	"link-shortener-backend/src/pages"
+	"link-shortener-backend/src/quota"
 	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/rules"
 	"net/http"
-	"regexp"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -14,138 +15,194 @@ import (
 
 // Redirect is a function that redirects a user to a new URL based on the redirect rules
 func Redirect(c *gin.Context) {
-	headers := c.Request.Header
-	cookies := c.Request.Cookies()
 	shortId := c.Param("shortId")
-	link, err := repository.GetLinkByShortId(shortId)
+	link, err := getRequestLink(c, shortId)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link"})
+		return
+	}
+	if link == nil {
+		renderNotFoundPage(c, shortId)
+		return
+	}
+	if link.Status == repository.LinkPaused {
+		recordClick(c, link, repository.Click{Paused: true})
+	}
+	if serveUnavailableLink(c, link) {
+		return
+	}
+	// Password protected links need a valid unlock cookie before redirecting
+	passwordPassed := false
+	if link.PasswordHash != nil {
+		unlockToken, err := c.Cookie(linkUnlockCookieName(link.ID))
+		if err != nil || !ValidateLinkUnlockToken(unlockToken, link.ID) {
+			renderPasswordPage(c, http.StatusOK, link.ShortId, "")
+			return
+		}
+		passwordPassed = true
+	}
+	ruleSet, err := linkCache.Rules(link.ID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get redirects"})
 		return
 	}
-	// Record a click to the database for statistics
-	// Country will be added later using a 3rd party service or IP geolocation
-	click := repository.Click{
-		LinkID:    link.ID,
-		UserAgent: headers.Get("User-Agent"),
-		Referer:   headers.Get("Referer"),
-		CreatedAt: time.Now(),
-		IP:        c.ClientIP(),
-	}
-	repository.CreateClick(click)
-	// Update the link's click count by 1
-	err = repository.UpdateLinkClickCount(link.ID)
+	// The first rule in priority order wins, without a match the visitor goes to one of the link's variants
+	// or to the original link
+	request := rules.NewRequest(c.Request, c.ClientIP(), clock())
+	if ruleSet.UsesCountry() {
+		request.Country = lookupCountry(request.IP)
+	}
+	click := repository.Click{PasswordPassed: passwordPassed}
+	destination := link.Original
+	if redirect := ruleSet.Match(&request); redirect != nil {
+		destination = redirect.RedirectURL
+	} else if variant := chooseVariant(c, link); variant != nil {
+		destination = variant.URL
+		click.VariantID = &variant.ID
+	}
+	if link.ForwardQuery {
+		destination = rules.ForwardQuery(destination, request.Query)
+	}
+	// Clicks over the monthly limit of the owner's package are not tracked
+	overQuota, err := quota.ClicksExceeded(link.CreatedBy)
 	if err != nil {
 		fmt.Println(err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update link click count"})
+	}
+	if !overQuota {
+		recordClick(c, link, click)
+	}
+	if overQuota && quota.Policy == quota.PolicyInterstitial {
+		renderPage(c, http.StatusOK, pages.Upgrade, pages.UpgradeData{Destination: destination})
 		return
 	}
-	redirects, err := repository.GetRedirectsByLinkID(strconv.Itoa(link.ID))
+	c.Redirect(http.StatusFound, destination)
+}
+
+// UnlockLink checks the password submitted from the password page and remembers the unlock in a signed cookie
+func UnlockLink(c *gin.Context) {
+	shortId := c.Param("shortId")
+	link, err := getRequestLink(c, shortId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get redirects"})
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link"})
+		return
+	}
+	if link == nil {
+		renderNotFoundPage(c, shortId)
+		return
+	}
+	if serveUnavailableLink(c, link) {
 		return
 	}
-	// Check if headers match any of the redirect rules
-	headerRedirect := headerCheck(headers, redirects)
-	if headerRedirect != nil {
-		c.Redirect(http.StatusFound, headerRedirect.RedirectURL)
+	if link.PasswordHash == nil {
+		c.Redirect(http.StatusSeeOther, "/"+link.ShortId)
 		return
 	}
-	cookieRedirect := cookieCheck(cookies, redirects)
-	if cookieRedirect != nil {
-		c.Redirect(http.StatusFound, cookieRedirect.RedirectURL)
+	if !VerifyPassword(*link.PasswordHash, c.PostForm("password")) {
+		renderPasswordPage(c, http.StatusUnauthorized, link.ShortId, "Incorrect password")
+		return
+	}
+	token, err := GenerateLinkUnlockToken(link.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock link"})
 		return
 	}
-	// No redirect matched, redirect to the original link
-	c.Redirect(http.StatusFound, link.Original)
+	c.SetCookie(
+		linkUnlockCookieName(link.ID),
+		token,
+		int(linkUnlockDuration.Seconds()),
+		"/"+link.ShortId,
+		"",
+		settings.CookieSecure,
+		true, // HttpOnly
+	)
+	c.Redirect(http.StatusSeeOther, "/"+link.ShortId)
+}
 
+// getRequestLink gets the link with the short id on the domain the request was made to
+func getRequestLink(c *gin.Context, shortId string) (*repository.Link, error) {
+	domain, err := requestDomain(c)
+	if err != nil {
+		return nil, err
+	}
+	return linkCache.Link(shortId, domainID(domain))
 }
 
-func cookieCheck(cookies []*http.Cookie, redirects []repository.Redirect) *repository.Redirect {
-	for _, redirect := range redirects {
-		if redirect.TargetType == "cookie" && redirect.TargetName != nil {
-			for _, cookie := range cookies {
-				if cookie.Name == *redirect.TargetName {
-					switch redirect.TargetMethod {
-					case "match":
-						if redirect.TargetValue != nil && *redirect.TargetValue == cookie.Value {
-							return &redirect
-						}
-					case "regex":
-						if redirect.TargetValue != nil && regexMatch(cookie.Value, *redirect.TargetValue) {
-							return &redirect
-						}
-					case "contains":
-						if redirect.TargetValue != nil && containsMatch(cookie.Value, *redirect.TargetValue) {
-							return &redirect
-						}
-					case "startsWith":
-						if redirect.TargetValue != nil && startsWithMatch(cookie.Value, *redirect.TargetValue) {
-							return &redirect
-						}
-					case "endsWith":
-						if redirect.TargetValue != nil && endsWithMatch(cookie.Value, *redirect.TargetValue) {
-							return &redirect
-						}
-					}
-				}
-			}
-		}
+// recordClick records a visit for statistics, it is written in the background so analytics can not fail the redirect.
+// click carries the details specific to the visit, the request details are filled in here
+func recordClick(c *gin.Context, link *repository.Link, click repository.Click) {
+	headers := c.Request.Header
+	click.LinkID = link.ID
+	click.UserAgent = headers.Get("User-Agent")
+	click.Referer = headers.Get("Referer")
+	click.CreatedAt = time.Now()
+	click.IP = c.ClientIP()
+	// The location is filled in from the ip when the click is written
+	clickQueue.Enqueue(click)
+}
+
+// lookupCountry returns the country code of the ip, empty when it is unknown
+func lookupCountry(ip string) string {
+	location, err := locator.Lookup(ip)
+	if err != nil {
+		fmt.Println(err)
 	}
-	return nil
+	return location.Country
 }
 
-func headerCheck(headers http.Header, redirects []repository.Redirect) *repository.Redirect {
-	for _, redirect := range redirects {
-		if redirect.TargetType == "header" && redirect.TargetName != nil {
-			for headerKey, headerValues := range headers {
-				if *redirect.TargetName == headerKey {
-					for _, headerValue := range headerValues {
-						switch redirect.TargetMethod {
-						case "match":
-							if redirect.TargetValue != nil && *redirect.TargetValue == headerValue {
-								return &redirect
-							}
-						case "regex":
-							if redirect.TargetValue != nil && regexMatch(headerValue, *redirect.TargetValue) {
-								return &redirect
-							}
-						case "contains":
-							if redirect.TargetValue != nil && containsMatch(headerValue, *redirect.TargetValue) {
-								return &redirect
-							}
-						case "startsWith":
-							if redirect.TargetValue != nil && startsWithMatch(headerValue, *redirect.TargetValue) {
-								return &redirect
-							}
-						case "endsWith":
-							if redirect.TargetValue != nil && endsWithMatch(headerValue, *redirect.TargetValue) {
-								return &redirect
-							}
-						}
-					}
-				}
-			}
+// serveUnavailableLink answers requests for disabled, paused and expired links and reports whether it did.
+// Paused links go to their paused url and expired links to their fallback url when they have one
+func serveUnavailableLink(c *gin.Context, link *repository.Link) bool {
+	switch {
+	case link.Status == repository.LinkDisabled:
+		renderLinkPage(c, http.StatusUnavailableForLegalReasons, pages.Blocked, link.CreatedBy, link.ShortId)
+	case link.Status == repository.LinkPaused:
+		if link.PausedURL != nil {
+			c.Redirect(http.StatusFound, *link.PausedURL)
+			return true
+		}
+		renderLinkPage(c, http.StatusServiceUnavailable, pages.Paused, link.CreatedBy, link.ShortId)
+	case link.IsExpired(time.Now()):
+		if link.FallbackURL != nil && *link.FallbackURL != "" {
+			c.Redirect(http.StatusFound, *link.FallbackURL)
+			return true
 		}
+		renderLinkPage(c, http.StatusGone, pages.Expired, link.CreatedBy, link.ShortId)
+	default:
+		return false
 	}
-	return nil
+	return true
 }
 
-func startsWithMatch(headerValue string, targetValue string) bool {
-	return strings.HasPrefix(headerValue, targetValue)
+// renderNotFoundPage renders the not found page, on a custom domain the domain owner's template is used
+func renderNotFoundPage(c *gin.Context, shortId string) {
+	ownerID := ""
+	domain, err := requestDomain(c)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if domain != nil {
+		ownerID = domain.UserID
+	}
+	renderLinkPage(c, http.StatusNotFound, pages.NotFound, ownerID, shortId)
 }
 
-func endsWithMatch(headerValue string, targetValue string) bool {
-	return strings.HasSuffix(headerValue, targetValue)
+func linkUnlockCookieName(linkID int) string {
+	return "link_unlock_" + strconv.Itoa(linkID)
 }
 
-func containsMatch(headerValue string, targetValue string) bool {
-	return strings.Contains(headerValue, targetValue)
+func renderPasswordPage(c *gin.Context, status int, shortId string, message string) {
+	renderPage(c, status, pages.Password, pages.PasswordData{ShortId: shortId, Error: message})
 }
 
-func regexMatch(headerValue string, regex string) bool {
-	re, err := regexp.Compile(regex)
+func renderPage(c *gin.Context, status int, name string, data any) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	err := pages.Render(c.Writer, name, data)
 	if err != nil {
-		return false
+		fmt.Println(err)
 	}
-	return re.MatchString(headerValue)
 }
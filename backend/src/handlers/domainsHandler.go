@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"link-shortener-backend/src/domains"
+	"link-shortener-backend/src/quota"
+	"link-shortener-backend/src/repository"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DomainVerifier checks the DNS ownership records of custom domains
+var DomainVerifier = domains.DefaultVerifier
+
+type CreateDomainRequest struct {
+	Hostname string `json:"hostname"`
+}
+
+// DomainResponse is a domain together with the TXT record that proves its ownership
+type DomainResponse struct {
+	repository.Domain
+	RecordName  string `json:"recordName"`
+	RecordValue string `json:"recordValue"`
+}
+
+func newDomainResponse(domain repository.Domain) DomainResponse {
+	return DomainResponse{
+		Domain:      domain,
+		RecordName:  domains.RecordName(domain.Hostname),
+		RecordValue: domains.RecordValue(domain.VerificationToken),
+	}
+}
+
+// CreateDomain registers a custom domain for the user, it has to be verified before links can use it
+func CreateDomain(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request CreateDomainRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	hostname, err := domains.NormalizeHostname(request.Hostname)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err = quota.CheckDomainQuota(user)
+	if err == quota.ErrDomainLimitReached {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	token, err := domains.NewToken()
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	domain, err := repository.CreateDomain(repository.Domain{
+		UserID:            user.ID,
+		Hostname:          hostname,
+		VerificationToken: token,
+		CreatedAt:         time.Now(),
+	})
+	if err == repository.ErrDomainTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, newDomainResponse(domain))
+}
+
+func GetDomains(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	userDomains, err := repository.GetDomainsByUser(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response := make([]DomainResponse, 0, len(userDomains))
+	for _, domain := range userDomains {
+		response = append(response, newDomainResponse(domain))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// VerifyDomain looks up the TXT record of the domain and marks it verified when the token matches
+func VerifyDomain(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	domain, err := repository.GetDomain(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if domain == nil || domain.UserID != user.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain not found"})
+		return
+	}
+	if domain.VerifiedAt == nil {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+		defer cancel()
+		verified, err := DomainVerifier.Verify(ctx, domain.Hostname, domain.VerificationToken)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to look up the verification record"})
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Verification record not found", "domain": newDomainResponse(*domain)})
+			return
+		}
+		now := time.Now()
+		err = repository.MarkDomainVerified(domain.ID, now)
+		if err == repository.ErrDomainTaken {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		domain.VerifiedAt = &now
+		linkCache.InvalidateDomain(domain.Hostname)
+	}
+	c.JSON(http.StatusOK, newDomainResponse(*domain))
+}
+
+func DeleteDomain(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	domain, err := repository.GetDomain(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	err = repository.DeleteDomain(c.Param("id"), user.ID)
+	if err == repository.ErrDomainInUse {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if domain != nil {
+		linkCache.InvalidateDomain(domain.Hostname)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Domain deleted successfully"})
+}
+
+// requestDomain returns the verified custom domain the request was made to, nil for the default domain
+func requestDomain(c *gin.Context) (*repository.Domain, error) {
+	host := c.Request.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+	return linkCache.Domain(strings.ToLower(host))
+}
+
+// userDomain returns the verified domain with the id if it belongs to the user
+func userDomain(user *repository.User, domainID int) (*repository.Domain, error) {
+	domain, err := repository.GetDomain(strconv.Itoa(domainID))
+	if err != nil || domain == nil {
+		return nil, err
+	}
+	if domain.UserID != user.ID || domain.VerifiedAt == nil {
+		return nil, nil
+	}
+	return domain, nil
+}
+
+// shortBaseURL returns the url prefix of short links on the domain
+func shortBaseURL(domain *repository.Domain) string {
+	if domain == nil {
+		return settings.BaseURL
+	}
+	return "https://" + domain.Hostname + "/"
+}
+
+func domainID(domain *repository.Domain) *int {
+	if domain == nil {
+		return nil
+	}
+	return &domain.ID
+}
@@ -1,37 +1,368 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"link-shortener-backend/src/quota"
 	"link-shortener-backend/src/repository"
-	"math/rand"
+	"link-shortener-backend/src/safety"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// TODO: Overwrite the link creation details with server info
+var (
+	ErrAliasInvalid  = errors.New("alias must be 3-64 characters long and contain only letters, digits, '-' or '_'")
+	ErrAliasReserved = errors.New("alias is reserved")
+	ErrAliasTaken    = errors.New("alias is already taken")
+)
+
+// aliasPattern is the character set allowed in custom aliases
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{3,64}$`)
+
+// reservedAliases can not be used as custom aliases because they clash with routes in main.go
+var reservedAliases = map[string]bool{
+	"api":     true,
+	"admin":   true,
+	"static":  true,
+	"assets":  true,
+	"metrics": true,
+	"report":  true,
+}
+
+type CreateLinkRequest struct {
+	Original    string     `json:"original"`
+	Alias       string     `json:"alias"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	MaxClicks   *int       `json:"maxClicks"`
+	FallbackURL *string    `json:"fallbackURL"`
+	Password    string     `json:"password"`
+	Title       *string    `json:"title"`
+	Tags        []string   `json:"tags"`
+	DomainID    *int       `json:"domainId"`
+	// ForwardQuery appends the query string of the short link to the destination
+	ForwardQuery bool `json:"forwardQuery"`
+}
+
+// UpdateLinkRequest replaces the editable fields of a link. An empty alias keeps the current short id,
+// a nil password keeps the current password and an empty one removes it
+type UpdateLinkRequest struct {
+	Original     string     `json:"original"`
+	Alias        string     `json:"alias"`
+	ExpiresAt    *time.Time `json:"expiresAt"`
+	MaxClicks    *int       `json:"maxClicks"`
+	FallbackURL  *string    `json:"fallbackURL"`
+	Password     *string    `json:"password"`
+	Title        *string    `json:"title"`
+	Tags         []string   `json:"tags"`
+	ForwardQuery bool       `json:"forwardQuery"`
+}
+
+// ValidateAlias checks that a custom alias has the right format and is not reserved
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return ErrAliasInvalid
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return ErrAliasReserved
+	}
+	return nil
+}
+
 // CreateLink creates a new link
 func CreateLink(c *gin.Context) {
 	user := c.MustGet("user").(*repository.User)
-	domain := "http://localhost:8080/" // TODO: Change to env variable later or whatever
-	shortLink := GenerateShortLink()
-	body := repository.Link{}
-	c.BindJSON(&body)
-	body.CreatedAt = time.Now()
-	body.CreatedBy = user.ID
-	body.Short = domain + shortLink
-	body.ShortId = shortLink
-	body.Clicks = 0
-	link, err := repository.CreateLink(body)
+	var request CreateLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry date must be in the future"})
+		return
+	}
+	if request.MaxClicks != nil && *request.MaxClicks <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Max clicks must be greater than zero"})
+		return
+	}
+	if !checkDestination(c, "Destination", request.Original) {
+		return
+	}
+	if request.FallbackURL != nil && !checkDestination(c, "Fallback URL", *request.FallbackURL) {
+		return
+	}
+	maxLinks, err := quota.LinkLimit(user)
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	body := repository.Link{
+		Original:     request.Original,
+		CreatedAt:    time.Now(),
+		CreatedBy:    user.ID,
+		Clicks:       0,
+		ExpiresAt:    request.ExpiresAt,
+		MaxClicks:    request.MaxClicks,
+		FallbackURL:  request.FallbackURL,
+		Title:        request.Title,
+		Tags:         request.Tags,
+		ForwardQuery: request.ForwardQuery,
+	}
+	if request.Password != "" {
+		hashedPassword, err := HashPassword(request.Password)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		body.PasswordHash = &hashedPassword
+	}
+	var domain *repository.Domain
+	if request.DomainID != nil {
+		domain, err = userDomain(user, *request.DomainID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if domain == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Domain not found or not verified"})
+			return
+		}
+		body.DomainID = &domain.ID
+	}
+	if request.Alias != "" {
+		if err := ValidateAlias(request.Alias); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		taken, err := repository.ShortIdExists(request.Alias, body.DomainID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": ErrAliasTaken.Error()})
+			return
+		}
+		body.ShortId = request.Alias
+	}
+	link, err := repository.CreateLink(body, shortBaseURL(domain), maxLinks)
+	if err == quota.ErrLinkLimitReached {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err == repository.ErrShortIdTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrAliasTaken.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The short id may have been cached as missing before the link existed
+	linkCache.InvalidateLink(link.ShortId, link.DomainID)
 	c.JSON(http.StatusOK, link)
 }
 
+// UpdateLink changes the destination, alias and metadata of a link owned by the user
+func UpdateLink(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request UpdateLinkRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, err := repository.GetLink(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	if link.CreatedBy != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this link"})
+		return
+	}
+	if request.Original == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Destination is required"})
+		return
+	}
+	// Only a changed expiry date has to be in the future, so saving other fields of an expired link still works
+	expiryChanged := request.ExpiresAt != nil && (link.ExpiresAt == nil || !request.ExpiresAt.Equal(*link.ExpiresAt))
+	if expiryChanged && !request.ExpiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expiry date must be in the future"})
+		return
+	}
+	if request.MaxClicks != nil && *request.MaxClicks <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Max clicks must be greater than zero"})
+		return
+	}
+	if !checkDestination(c, "Destination", request.Original) {
+		return
+	}
+	if request.FallbackURL != nil && !checkDestination(c, "Fallback URL", *request.FallbackURL) {
+		return
+	}
+
+	updated := *link
+	updated.Original = request.Original
+	updated.ExpiresAt = request.ExpiresAt
+	updated.MaxClicks = request.MaxClicks
+	updated.FallbackURL = request.FallbackURL
+	updated.Title = request.Title
+	updated.Tags = request.Tags
+	updated.ForwardQuery = request.ForwardQuery
+	if request.Alias != "" && request.Alias != link.ShortId {
+		if err := ValidateAlias(request.Alias); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updated.ShortId = request.Alias
+	}
+	if request.Password != nil {
+		updated.PasswordHash = nil
+		if *request.Password != "" {
+			hashedPassword, err := HashPassword(*request.Password)
+			if err != nil {
+				fmt.Println(err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			updated.PasswordHash = &hashedPassword
+		}
+	}
+
+	var domain *repository.Domain
+	if link.DomainID != nil {
+		domain, err = repository.GetDomain(strconv.Itoa(*link.DomainID))
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	saved, err := repository.UpdateLink(*link, updated, shortBaseURL(domain), user.ID)
+	if err == repository.ErrShortIdTaken {
+		c.JSON(http.StatusConflict, gin.H{"error": ErrAliasTaken.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidateLink(link.ShortId, link.DomainID)
+	linkCache.InvalidateLink(saved.ShortId, saved.DomainID)
+	c.JSON(http.StatusOK, saved)
+}
+
+// PauseLinkRequest optionally sets where visitors go while the link is paused
+type PauseLinkRequest struct {
+	PausedURL *string `json:"pausedURL"`
+}
+
+// PauseLink stops redirecting a link owned by the user without deleting it
+func PauseLink(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request PauseLinkRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if request.PausedURL != nil && *request.PausedURL == "" {
+		request.PausedURL = nil
+	}
+	if request.PausedURL != nil && !checkDestination(c, "Paused URL", *request.PausedURL) {
+		return
+	}
+	setLinkStatus(c, user, repository.LinkPaused, request.PausedURL)
+}
+
+// ResumeLink makes a paused link redirect again
+func ResumeLink(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	setLinkStatus(c, user, repository.LinkActive, nil)
+}
+
+func setLinkStatus(c *gin.Context, user *repository.User, status repository.LinkStatus, pausedURL *string) {
+	link, err := repository.GetLink(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	if link.CreatedBy != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this link"})
+		return
+	}
+	if link.Status == repository.LinkDisabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Link has been disabled and can not be paused or resumed"})
+		return
+	}
+	saved, err := repository.SetLinkStatus(*link, status, pausedURL, user.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidateLink(saved.ShortId, saved.DomainID)
+	c.JSON(http.StatusOK, saved)
+}
+
+// checkDestination runs the url safety checks on a destination, label names the field in the error.
+// It writes the error response and returns false when the url can not be used
+func checkDestination(c *gin.Context, label string, value string) bool {
+	err := urlChecker.Check(value)
+	if err == nil {
+		return true
+	}
+	if safety.Unsafe(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": label + ": " + err.Error()})
+		return false
+	}
+	fmt.Println(err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	return false
+}
+
+// GetLinkHistory gets the audit history of a link owned by the user
+func GetLinkHistory(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	isOwned, err := CheckLinkOwnership(c.Param("id"), user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !isOwned {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this link"})
+		return
+	}
+	history, err := repository.GetLinkHistory(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
 func CreateClick(c *gin.Context) {
 	body := repository.Click{}
 	c.BindJSON(&body)
@@ -67,19 +398,6 @@ func GetAllLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, links)
 }
 
-func GenerateShortLink() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 6
-
-	shortLink := make([]byte, length)
-	rand := rand.New(rand.NewSource(time.Now().UnixNano()))
-	for i := range shortLink {
-		shortLink[i] = charset[rand.Intn(len(charset))]
-	}
-
-	return string(shortLink)
-}
-
 func GetRecentLinks(c *gin.Context) {
 	user := c.MustGet("user").(*repository.User)
 	allLinks, err := repository.GetRecentLinks(user.ID)
@@ -91,13 +409,99 @@ func GetRecentLinks(c *gin.Context) {
 	c.JSON(http.StatusOK, allLinks)
 }
 
+// GetExpiredLinks gets the links of the user that have expired by date or click budget
+func GetExpiredLinks(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	links, err := repository.GetExpiredLinks(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, links)
+}
+
+// DeleteLink moves a link of the user to the trash
 func DeleteLink(c *gin.Context) {
 	user := c.MustGet("user").(*repository.User)
-	err := repository.DeleteLink(c.Param("id"), user.ID)
+	link, err := repository.GetLink(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	deleted, err := repository.DeleteLink(c.Param("id"), user.ID)
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if !deleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+	if link != nil {
+		linkCache.InvalidateLink(link.ShortId, link.DomainID)
+		linkCache.InvalidateRedirects(link.ID)
+		linkCache.InvalidateVariants(link.ID)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Link deleted successfully"})
 }
+
+// TrashLink is a deleted link together with the time it will be purged
+type TrashLink struct {
+	repository.Link
+	PurgeAt time.Time `json:"purgeAt"`
+}
+
+// GetDeletedLinks lists the links of the user that are in the trash
+func GetDeletedLinks(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	links, err := repository.GetDeletedLinks(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	trash := make([]TrashLink, 0, len(links))
+	for _, link := range links {
+		trash = append(trash, TrashLink{Link: link, PurgeAt: link.DeletedAt.Add(settings.TrashRetention.Duration)})
+	}
+	c.JSON(http.StatusOK, trash)
+}
+
+// RestoreLink takes a link of the user out of the trash while it is within the retention period
+func RestoreLink(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	maxLinks, err := quota.LinkLimit(user)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	restored, err := repository.RestoreLink(c.Param("id"), user.ID, time.Now().Add(-settings.TrashRetention.Duration), maxLinks)
+	if err == quota.ErrLinkLimitReached {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !restored {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found in the trash"})
+		return
+	}
+	link, err := repository.GetLink(c.Param("id"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	// The short id is cached as missing while the link was deleted
+	if link != nil {
+		linkCache.InvalidateLink(link.ShortId, link.DomainID)
+	}
+	c.JSON(http.StatusOK, link)
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"link-shortener-backend/src/pages"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SavePageTemplateRequest struct {
+	Body string `json:"body"`
+}
+
+// GetPageTemplates gets the custom pages of the user
+func GetPageTemplates(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	pageTemplates, err := repository.GetPageTemplates(user.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pageTemplates)
+}
+
+// SavePageTemplate replaces the not_found, paused or expired page shown for the user's links
+func SavePageTemplate(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	page := c.Param("page")
+	if _, ok := pages.Customizable[page]; !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page can not be customized"})
+		return
+	}
+	var request SavePageTemplateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := pages.ParseCustom(request.Body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template: " + err.Error()})
+		return
+	}
+	pageTemplate, err := repository.SavePageTemplate(repository.PageTemplate{
+		UserID:    user.ID,
+		Page:      page,
+		Body:      request.Body,
+		UpdatedAt: time.Now(),
+	})
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidatePage(user.ID, page)
+	c.JSON(http.StatusOK, pageTemplate)
+}
+
+// DeletePageTemplate goes back to the built in page
+func DeletePageTemplate(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	err := repository.DeletePageTemplate(user.ID, c.Param("page"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidatePage(user.ID, c.Param("page"))
+	c.JSON(http.StatusOK, gin.H{"message": "Page deleted successfully"})
+}
+
+// renderLinkPage renders a page about the link, using the owner's custom template when they uploaded one
+func renderLinkPage(c *gin.Context, status int, name string, ownerID string, shortId string) {
+	data := pages.LinkData{ShortId: shortId}
+	custom := pages.CustomName(name)
+	if ownerID == "" || custom == "" {
+		renderPage(c, status, name, data)
+		return
+	}
+	pageTemplate, err := linkCache.Page(ownerID, custom)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get page"})
+		return
+	}
+	if pageTemplate == nil {
+		renderPage(c, status, name, data)
+		return
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Security-Policy", pages.CustomPolicy)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(status)
+	if err := pages.RenderCustom(c.Writer, pageTemplate, name, data); err != nil {
+		fmt.Println(err)
+	}
+}
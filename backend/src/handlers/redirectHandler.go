@@ -3,25 +3,97 @@ package handlers
 import (
 	"fmt"
 	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/rules"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// RedirectStore is the storage the rule handlers read links and rules from and write rules to
+type RedirectStore interface {
+	GetLink(id string) (*repository.Link, error)
+	GetRedirect(id string) (*repository.Redirect, error)
+	GetRedirectsByLinkID(linkID string) ([]repository.Redirect, error)
+	CreateRedirect(redirect repository.Redirect) (repository.Redirect, error)
+	UpdateRedirect(redirect repository.Redirect) (repository.Redirect, error)
+	DeleteRedirect(id string) error
+	ReorderRedirects(linkID int, ids []int) error
+	GetVariants(linkID int) ([]repository.Variant, error)
+}
+
+// RepositoryRedirectStore reads and writes rules in the database
+type RepositoryRedirectStore struct{}
+
+func (RepositoryRedirectStore) GetLink(id string) (*repository.Link, error) {
+	return repository.GetLink(id)
+}
+
+func (RepositoryRedirectStore) GetRedirect(id string) (*repository.Redirect, error) {
+	return repository.GetRedirect(id)
+}
+
+func (RepositoryRedirectStore) GetRedirectsByLinkID(linkID string) ([]repository.Redirect, error) {
+	return repository.GetRedirectsByLinkID(linkID)
+}
+
+func (RepositoryRedirectStore) CreateRedirect(redirect repository.Redirect) (repository.Redirect, error) {
+	return repository.CreateRedirect(redirect)
+}
+
+func (RepositoryRedirectStore) UpdateRedirect(redirect repository.Redirect) (repository.Redirect, error) {
+	return repository.UpdateRedirect(redirect)
+}
+
+func (RepositoryRedirectStore) DeleteRedirect(id string) error {
+	return repository.DeleteRedirect(id)
+}
+
+func (RepositoryRedirectStore) ReorderRedirects(linkID int, ids []int) error {
+	return repository.ReorderRedirects(linkID, ids)
+}
+
+func (RepositoryRedirectStore) GetVariants(linkID int) ([]repository.Variant, error) {
+	return repository.GetVariants(linkID)
+}
+
+// redirectStore is used by the rule handlers and ownedLink, tests can replace it
+var redirectStore RedirectStore = RepositoryRedirectStore{}
+
+// CreateRedirect adds a rule to a link owned by the user, it is evaluated after the existing rules
 func CreateRedirect(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
 	body := repository.Redirect{}
-	c.BindJSON(&body)
-	redirect, err := repository.CreateRedirect(body)
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := ownedLink(c, user, strconv.Itoa(body.LinkID)); !ok {
+		return
+	}
+	if !validateRedirect(c, &body) {
+		return
+	}
+	redirect, err := redirectStore.CreateRedirect(body)
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	linkCache.InvalidateRedirects(redirect.LinkID)
 	c.JSON(http.StatusOK, redirect)
 }
 
+// GetRedirectsByLinkID gets the rules of a link owned by the user in evaluation order
 func GetRedirectsByLinkID(c *gin.Context) {
-	redirects, err := repository.GetRedirectsByLinkID(c.Param("linkID"))
+	user := c.MustGet("user").(*repository.User)
+	link, ok := ownedLink(c, user, c.Param("linkID"))
+	if !ok {
+		return
+	}
+	redirects, err := redirectStore.GetRedirectsByLinkID(strconv.Itoa(link.ID))
 	if err != nil {
 		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -30,22 +102,221 @@ func GetRedirectsByLinkID(c *gin.Context) {
 	c.JSON(http.StatusOK, redirects)
 }
 
+// DeleteRedirect deletes a rule of a link owned by the user
 func DeleteRedirect(c *gin.Context) {
-	err := repository.DeleteRedirect(c.Param("redirectID"))
+	user := c.MustGet("user").(*repository.User)
+	existing, ok := ownedRedirect(c, user, c.Param("redirectID"))
+	if !ok {
+		return
+	}
+	err := redirectStore.DeleteRedirect(strconv.Itoa(existing.ID))
+	linkCache.InvalidateRedirects(existing.LinkID)
 	if err != nil {
+		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Redirect deleted"})
 }
 
+// UpdateRedirect replaces the condition and destination of a rule of a link owned by the user.
+// The rule is the one in the path, the id and link id of the body are ignored
 func UpdateRedirect(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
 	body := repository.Redirect{}
-	c.BindJSON(&body)
-	redirect, err := repository.UpdateRedirect(body)
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	existing, ok := ownedRedirect(c, user, c.Param("redirectID"))
+	if !ok {
+		return
+	}
+	body.ID = existing.ID
+	body.LinkID = existing.LinkID
+	if !validateRedirect(c, &body) {
+		return
+	}
+	redirect, err := redirectStore.UpdateRedirect(body)
+	linkCache.InvalidateRedirects(existing.LinkID)
 	if err != nil {
+		fmt.Println(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, redirect)
 }
+
+// ownedRedirect gets a rule of a link owned by the user, it writes the error response and returns false otherwise.
+// Rules of links the user does not own get the same response as the links themselves
+func ownedRedirect(c *gin.Context, user *repository.User, id string) (*repository.Redirect, bool) {
+	redirect, err := redirectStore.GetRedirect(id)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if redirect == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Redirect not found"})
+		return nil, false
+	}
+	if _, ok := ownedLink(c, user, strconv.Itoa(redirect.LinkID)); !ok {
+		return nil, false
+	}
+	return redirect, true
+}
+
+// validateRedirect checks the destination and condition of a rule, rules sent with only target fields get a single
+// condition built from them, so their type and method are checked like those of a condition.
+// It writes the error response and returns false when the rule is invalid
+func validateRedirect(c *gin.Context, redirect *repository.Redirect) bool {
+	if !checkDestination(c, "Redirect URL", redirect.RedirectURL) {
+		return false
+	}
+	if redirect.Condition == nil && redirect.TargetType != "" {
+		redirect.Condition = rules.LegacyCondition(*redirect)
+	}
+	if err := rules.ValidateCondition(redirect.Condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	// The target fields mirror plain single conditions so older clients keep showing them, other rules leave them empty
+	condition := redirect.Condition
+	if condition.Type == "" || condition.IgnoreCase || condition.Negate {
+		condition = &repository.Condition{}
+	}
+	redirect.TargetType = condition.Type
+	redirect.TargetMethod = condition.Method
+	redirect.TargetName = condition.Name
+	redirect.TargetValue = condition.Value
+	redirect.Schedule = condition.Schedule
+	return true
+}
+
+type ReorderRedirectsRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// ReorderRedirects sets the evaluation order of the rules of a link owned by the user
+func ReorderRedirects(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request ReorderRedirectsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, ok := ownedLink(c, user, c.Param("linkID"))
+	if !ok {
+		return
+	}
+	err := redirectStore.ReorderRedirects(link.ID, request.IDs)
+	if err == repository.ErrRedirectOrderMismatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidateRedirects(link.ID)
+	redirects, err := redirectStore.GetRedirectsByLinkID(strconv.Itoa(link.ID))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, redirects)
+}
+
+// TestRedirectsRequest is a sample visit, headers, cookies and query parameters map names to values.
+// The country is looked up from the ip when it is not given
+type TestRedirectsRequest struct {
+	Headers map[string]string `json:"headers"`
+	Cookies map[string]string `json:"cookies"`
+	Query   map[string]string `json:"query"`
+	IP      string            `json:"ip"`
+	Country string            `json:"country"`
+	// Time is when the sample visit happens, now when it is not given
+	Time *time.Time `json:"time"`
+}
+
+type TestRedirectsResponse struct {
+	// Redirect is the rule that would fire, nil when the visitor would go to the original link
+	Redirect    *repository.Redirect `json:"redirect"`
+	Destination string               `json:"destination"`
+	// Country and Agent are what the rules saw, to explain why a rule did or did not match
+	Country string      `json:"country"`
+	Agent   rules.Agent `json:"agent"`
+	// Variants are the destinations the visitor is split across when no rule matched
+	Variants []repository.Variant `json:"variants"`
+}
+
+// TestRedirects reports which rule of a link would fire for a sample request without recording a click
+func TestRedirects(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request TestRedirectsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, ok := ownedLink(c, user, c.Param("linkID"))
+	if !ok {
+		return
+	}
+	redirects, err := redirectStore.GetRedirectsByLinkID(strconv.Itoa(link.ID))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	sample := rules.Request{Headers: http.Header{}, Cookies: request.Cookies, Query: url.Values{}, IP: request.IP, Country: request.Country}
+	sample.Time = clock()
+	if request.Time != nil {
+		sample.Time = *request.Time
+	}
+	if sample.Country == "" && sample.IP != "" {
+		sample.Country = lookupCountry(sample.IP)
+	}
+	for name, value := range request.Headers {
+		sample.Headers.Set(name, value)
+	}
+	for name, value := range request.Query {
+		sample.Query.Set(name, value)
+	}
+	response := TestRedirectsResponse{Destination: link.Original, Country: sample.Country, Agent: sample.Agent()}
+	if redirect := rules.Match(redirects, sample); redirect != nil {
+		response.Redirect = redirect
+		response.Destination = redirect.RedirectURL
+	} else {
+		response.Variants, err = redirectStore.GetVariants(link.ID)
+		if err != nil {
+			fmt.Println(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if link.ForwardQuery {
+		response.Destination = rules.ForwardQuery(response.Destination, sample.Query)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ownedLink gets a link of the user, it writes the error response and returns false otherwise
+func ownedLink(c *gin.Context, user *repository.User, id string) (*repository.Link, bool) {
+	link, err := redirectStore.GetLink(id)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return nil, false
+	}
+	if link.CreatedBy != user.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this link"})
+		return nil, false
+	}
+	return link, true
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	// Schedule rules are evaluated in their timezone
+	_ "time/tzdata"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRedirectStore keeps links and rules in memory and counts the writes made to it
+type fakeRedirectStore struct {
+	links     map[int]repository.Link
+	redirects map[int]repository.Redirect
+	writes    int
+}
+
+func (s *fakeRedirectStore) GetLink(id string) (*repository.Link, error) {
+	linkID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, nil
+	}
+	link, ok := s.links[linkID]
+	if !ok {
+		return nil, nil
+	}
+	return &link, nil
+}
+
+func (s *fakeRedirectStore) GetRedirect(id string) (*repository.Redirect, error) {
+	redirectID, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, nil
+	}
+	redirect, ok := s.redirects[redirectID]
+	if !ok {
+		return nil, nil
+	}
+	return &redirect, nil
+}
+
+func (s *fakeRedirectStore) GetRedirectsByLinkID(linkID string) ([]repository.Redirect, error) {
+	redirects := make([]repository.Redirect, 0)
+	for _, redirect := range s.redirects {
+		if strconv.Itoa(redirect.LinkID) == linkID {
+			redirects = append(redirects, redirect)
+		}
+	}
+	return redirects, nil
+}
+
+func (s *fakeRedirectStore) CreateRedirect(redirect repository.Redirect) (repository.Redirect, error) {
+	s.writes++
+	redirect.ID = len(s.redirects) + 100
+	s.redirects[redirect.ID] = redirect
+	return redirect, nil
+}
+
+func (s *fakeRedirectStore) UpdateRedirect(redirect repository.Redirect) (repository.Redirect, error) {
+	s.writes++
+	s.redirects[redirect.ID] = redirect
+	return redirect, nil
+}
+
+func (s *fakeRedirectStore) DeleteRedirect(id string) error {
+	s.writes++
+	redirectID, _ := strconv.Atoi(id)
+	delete(s.redirects, redirectID)
+	return nil
+}
+
+func (s *fakeRedirectStore) ReorderRedirects(linkID int, ids []int) error {
+	s.writes++
+	return nil
+}
+
+func (s *fakeRedirectStore) GetVariants(linkID int) ([]repository.Variant, error) {
+	return nil, nil
+}
+
+const (
+	ownerID    = "00000000-0000-0000-0000-00000000000a"
+	intruderID = "00000000-0000-0000-0000-00000000000b"
+)
+
+// useFakeRedirectStore replaces the store with one holding link 1 and its rule 10, both owned by ownerID
+func useFakeRedirectStore(t *testing.T) *fakeRedirectStore {
+	value := "DE"
+	store := &fakeRedirectStore{
+		links: map[int]repository.Link{
+			1: {ID: 1, Original: "https://example.com/", ShortId: "abc", CreatedBy: ownerID},
+		},
+		redirects: map[int]repository.Redirect{
+			10: {ID: 10, LinkID: 1, RedirectURL: "https://example.com/de", Condition: &repository.Condition{Type: repository.Country, Method: repository.Match, Value: &value}},
+		},
+	}
+	previous := redirectStore
+	redirectStore = store
+	t.Cleanup(func() { redirectStore = previous })
+	return store
+}
+
+func redirectRouter(userID string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &repository.User{ID: userID})
+	})
+	router.POST("/redirects/create", CreateRedirect)
+	router.GET("/redirects/get/:linkID", GetRedirectsByLinkID)
+	router.DELETE("/redirects/delete/:redirectID", DeleteRedirect)
+	router.PUT("/redirects/update/:redirectID", UpdateRedirect)
+	router.PUT("/redirects/reorder/:linkID", ReorderRedirects)
+	router.POST("/redirects/test/:linkID", TestRedirects)
+	return router
+}
+
+const ruleBody = `{"linkID": 1, "redirectURL": "https://example.com/fr", "condition": {"type": "country", "method": "match", "value": "FR"}}`
+
+func TestRedirectsOfOtherUsers(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"create", http.MethodPost, "/redirects/create", ruleBody, http.StatusForbidden},
+		{"get", http.MethodGet, "/redirects/get/1", "", http.StatusForbidden},
+		{"update", http.MethodPut, "/redirects/update/10", ruleBody, http.StatusForbidden},
+		{"delete", http.MethodDelete, "/redirects/delete/10", "", http.StatusForbidden},
+		{"reorder", http.MethodPut, "/redirects/reorder/1", `{"ids": [10]}`, http.StatusForbidden},
+		{"test", http.MethodPost, "/redirects/test/1", `{"country": "DE"}`, http.StatusForbidden},
+		{"create on missing link", http.MethodPost, "/redirects/create", strings.Replace(ruleBody, `"linkID": 1`, `"linkID": 2`, 1), http.StatusNotFound},
+		{"update missing rule", http.MethodPut, "/redirects/update/11", ruleBody, http.StatusNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := useFakeRedirectStore(t)
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			redirectRouter(intruderID).ServeHTTP(recorder, request)
+
+			if recorder.Code != test.status {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, test.status, recorder.Body.String())
+			}
+			if store.writes != 0 {
+				t.Errorf("%d writes were made", store.writes)
+			}
+			if strings.Contains(recorder.Body.String(), "example.com/de") {
+				t.Errorf("response leaks the rule: %s", recorder.Body.String())
+			}
+			if len(store.redirects) != 1 {
+				t.Errorf("rules = %v, want only rule 10", store.redirects)
+			}
+		})
+	}
+}
+
+func TestRedirectsOfOwner(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		writes int
+	}{
+		{"create", http.MethodPost, "/redirects/create", ruleBody, 1},
+		{"update", http.MethodPut, "/redirects/update/10", ruleBody, 1},
+		{"get", http.MethodGet, "/redirects/get/1", "", 0},
+		{"delete", http.MethodDelete, "/redirects/delete/10", "", 1},
+		{"reorder", http.MethodPut, "/redirects/reorder/1", `{"ids": [10]}`, 1},
+		{"test", http.MethodPost, "/redirects/test/1", `{"country": "DE"}`, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := useFakeRedirectStore(t)
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(test.method, test.path, strings.NewReader(test.body))
+			redirectRouter(ownerID).ServeHTTP(recorder, request)
+
+			if recorder.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusOK, recorder.Body.String())
+			}
+			if store.writes != test.writes {
+				t.Errorf("writes = %d, want %d", store.writes, test.writes)
+			}
+		})
+	}
+}
+
+// ruleWith returns a rule body for link 1 with the destination and condition, the condition is JSON
+func ruleWith(destination string, condition string) string {
+	return `{"linkID": 1, "redirectURL": "` + destination + `", "condition": ` + condition + `}`
+}
+
+func TestInvalidRedirects(t *testing.T) {
+	country := `{"type": "country", "value": "FR"}`
+	deep := country
+	for i := 0; i < 8; i++ {
+		deep = `{"not": ` + deep + `}`
+	}
+	wide := `{"or": [` + strings.TrimSuffix(strings.Repeat(country+",", 32), ",") + `]}`
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"bad regex", ruleWith("https://example.com/", `{"type": "header", "method": "regex", "name": "Referer", "value": "("}`)},
+		{"unknown type", ruleWith("https://example.com/", `{"type": "planet", "value": "mars"}`)},
+		{"unknown method", ruleWith("https://example.com/", `{"type": "country", "method": "equals", "value": "FR"}`)},
+		{"missing name", ruleWith("https://example.com/", `{"type": "header", "value": "x"}`)},
+		{"unknown country", ruleWith("https://example.com/", `{"type": "country", "value": "France"}`)},
+		{"unsafe scheme", ruleWith("javascript:alert(1)", country)},
+		{"private network", ruleWith("http://127.0.0.1/admin", country)},
+		{"too deep", ruleWith("https://example.com/", deep)},
+		{"too many conditions", ruleWith("https://example.com/", wide)},
+		{"missing condition", `{"linkID": 1, "redirectURL": "https://example.com/"}`},
+	}
+	for _, test := range tests {
+		for _, endpoint := range []struct{ method, path string }{
+			{http.MethodPost, "/redirects/create"},
+			{http.MethodPut, "/redirects/update/10"},
+		} {
+			t.Run(test.name+" "+endpoint.path, func(t *testing.T) {
+				store := useFakeRedirectStore(t)
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest(endpoint.method, endpoint.path, strings.NewReader(test.body))
+				redirectRouter(ownerID).ServeHTTP(recorder, request)
+
+				if recorder.Code != http.StatusBadRequest {
+					t.Errorf("status = %d, want %d: %s", recorder.Code, http.StatusBadRequest, recorder.Body.String())
+				}
+				if store.writes != 0 {
+					t.Errorf("%d writes were made", store.writes)
+				}
+			})
+		}
+	}
+}
+
+func TestRedirectsTestAtClock(t *testing.T) {
+	store := useFakeRedirectStore(t)
+	store.redirects[11] = repository.Redirect{ID: 11, LinkID: 1, Priority: 1, RedirectURL: "https://example.com/office", Condition: &repository.Condition{
+		Type:     repository.Schedule,
+		Schedule: &repository.RedirectSchedule{Days: []string{"mon"}, From: "09:00", To: "17:00", Timezone: "Europe/Berlin"},
+	}}
+	previous := clock
+	t.Cleanup(func() { clock = previous })
+
+	tests := []struct {
+		name        string
+		now         time.Time
+		destination string
+	}{
+		// 2024-06-03 is a Monday, Berlin is two hours ahead of UTC in summer
+		{"inside hours", time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC), "https://example.com/office"},
+		{"after hours", time.Date(2024, 6, 3, 15, 0, 0, 0, time.UTC), "https://example.com/"},
+		{"other day", time.Date(2024, 6, 4, 8, 0, 0, 0, time.UTC), "https://example.com/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clock = func() time.Time { return test.now }
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/redirects/test/1", strings.NewReader(`{"country": "FR"}`))
+			redirectRouter(ownerID).ServeHTTP(recorder, request)
+
+			var response TestRedirectsResponse
+			if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Destination != test.destination {
+				t.Errorf("destination = %q, want %q", response.Destination, test.destination)
+			}
+		})
+	}
+}
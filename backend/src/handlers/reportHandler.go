@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	maxReportDetails = 2000
+	maxReportEmail   = 255
+	// maxOpenReports is how many reports a visitor ip may have waiting for review
+	maxOpenReports = 10
+)
+
+var reportReasons = map[repository.ReportReason]bool{
+	repository.ReportPhishing: true,
+	repository.ReportMalware:  true,
+	repository.ReportSpam:     true,
+	repository.ReportIllegal:  true,
+	repository.ReportOther:    true,
+}
+
+// ReportLinkRequest is an abuse report sent by a visitor, as JSON or a form
+type ReportLinkRequest struct {
+	Reason  repository.ReportReason `json:"reason" form:"reason"`
+	Details string                  `json:"details" form:"details"`
+	Email   string                  `json:"email" form:"email"`
+}
+
+// ReportLink files an abuse report about a short link, anyone can report without an account.
+// The link is looked up on the domain of the request like Redirect does
+func ReportLink(c *gin.Context) {
+	var request ReportLinkRequest
+	if err := c.ShouldBind(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !reportReasons[request.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason must be phishing, malware, spam, illegal or other"})
+		return
+	}
+	request.Details = strings.TrimSpace(request.Details)
+	request.Email = strings.TrimSpace(request.Email)
+	if len(request.Details) > maxReportDetails || len(request.Email) > maxReportEmail {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Details or email are too long"})
+		return
+	}
+
+	link, err := getRequestLink(c, c.Param("shortId"))
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get link"})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Link not found"})
+		return
+	}
+
+	report := repository.AbuseReport{
+		LinkID:     link.ID,
+		Reason:     request.Reason,
+		ReporterIP: c.ClientIP(),
+		CreatedAt:  time.Now(),
+	}
+	if request.Details != "" {
+		report.Details = &request.Details
+	}
+	if request.Email != "" {
+		report.ReporterEmail = &request.Email
+	}
+	// A repeated report from the same visitor is answered the same way, it just does not queue a duplicate
+	_, err = repository.CreateAbuseReport(report, maxOpenReports)
+	if err == repository.ErrReportLimit {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Thank you, the report will be reviewed"})
+}
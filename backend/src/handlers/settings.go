@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"fmt"
+	"link-shortener-backend/src/cache"
+	"link-shortener-backend/src/config"
+	"link-shortener-backend/src/geoip"
+	"link-shortener-backend/src/ingest"
+	"link-shortener-backend/src/metrics"
+	"link-shortener-backend/src/safety"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// settings are the server settings the handlers use, set once at startup
+var settings = config.Default()
+
+// clickQueue records the clicks of redirects in the background
+var clickQueue *ingest.Queue
+
+// linkCache caches the link, redirect and domain lookups of redirects
+var linkCache = cache.NewLinks(cache.NewMemoryStore(10000), 30*time.Second, 5*time.Second)
+
+// locator looks up the country of visitors for country rules
+var locator geoip.Locator = geoip.None{}
+
+// urlChecker decides whether urls may be used as destinations
+var urlChecker = safety.Default()
+
+// clock is the time redirect rules are evaluated at, tests can replace it with a fixed time
+var clock = time.Now
+
+// Configure sets the settings used by the handlers
+func Configure(cfg *config.Config) {
+	settings = cfg
+}
+
+// UseClickQueue sets the queue Redirect records clicks into
+func UseClickQueue(queue *ingest.Queue) {
+	clickQueue = queue
+}
+
+// UseLinkCache sets the cache used for the lookups of redirects
+func UseLinkCache(links *cache.Links) {
+	linkCache = links
+}
+
+// UseLocator sets the GeoIP database used for country rules
+func UseLocator(l geoip.Locator) {
+	locator = l
+}
+
+// UseURLChecker sets the checks destinations of links, rules and variants have to pass
+func UseURLChecker(checker *safety.Checker) {
+	urlChecker = checker
+}
+
+// Metrics exposes the internal counters in the Prometheus text format
+func Metrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+	if err := metrics.Write(c.Writer); err != nil {
+		fmt.Println(err)
+	}
+}
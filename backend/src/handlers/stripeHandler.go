@@ -7,7 +7,6 @@ import (
 	"io"
 	"link-shortener-backend/src/repository"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -27,7 +26,7 @@ type StripeCheckoutSession struct {
 
 func StripeCreateCheckoutSession(c *gin.Context) {
 
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	stripe.Key = settings.StripeSecretKey
 	var checkoutSessionBody StripeCheckoutSession
 	err := c.BindJSON(&checkoutSessionBody)
 	if err != nil {
@@ -61,8 +60,8 @@ func StripeCreateCheckoutSession(c *gin.Context) {
 			},
 		},
 		Mode:       stripe.String(string(stripe.CheckoutSessionModeSubscription)),
-		SuccessURL: stripe.String("http://localhost:3000/success?session_id={CHECKOUT_SESSION_ID}"),
-		CancelURL:  stripe.String("http://localhost:3000/cancel"),
+		SuccessURL: stripe.String(settings.FrontendURL + "/success?session_id={CHECKOUT_SESSION_ID}"),
+		CancelURL:  stripe.String(settings.FrontendURL + "/cancel"),
 	}
 
 	checkoutSession, err := session.New(params)
@@ -85,7 +84,7 @@ func StripeWebHook(c *gin.Context) {
 		return
 	}
 	signature := c.Request.Header.Get("Stripe-Signature")
-	event, err := webhook.ConstructEvent(payload, signature, os.Getenv("STRIPE_WEBHOOK_SECRET"))
+	event, err := webhook.ConstructEvent(payload, signature, settings.StripeWebhookSecret)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -189,6 +188,12 @@ func CreateSubscription(stripeSubscription *stripe.Subscription) error {
 		UpdatedAt:        time.Now(),
 	}
 
+	packageID, err := subscriptionPackageID(stripeSubscription)
+	if err != nil {
+		return err
+	}
+	subscription.PackageID = packageID
+
 	existingSubscription, err := repository.GetSubscriptionByCustomerId(subscription.CustomerID)
 	if err != nil {
 		return err
@@ -211,12 +216,31 @@ func UpdateSubscription(stripeSubscription *stripe.Subscription) error {
 		CreatedAt:        time.Now(),
 		UpdatedAt:        time.Now(),
 	}
+	// Upgrades and downgrades change the price of the subscription
+	packageID, err := subscriptionPackageID(stripeSubscription)
+	if err != nil {
+		return err
+	}
+	subscription.PackageID = packageID
 
-	_, err := repository.UpdateSubscription(*subscription)
+	_, err = repository.UpdateSubscription(*subscription)
 
 	return err
 }
 
+// subscriptionPackageID returns the package sold with the price of the subscription, quotas are based on it.
+// It is empty when the price belongs to no package
+func subscriptionPackageID(stripeSubscription *stripe.Subscription) (string, error) {
+	if stripeSubscription.Items == nil || len(stripeSubscription.Items.Data) == 0 || stripeSubscription.Items.Data[0].Price == nil {
+		return "", nil
+	}
+	subPackage, err := repository.GetPackageByPriceID(stripeSubscription.Items.Data[0].Price.ID)
+	if err != nil || subPackage == nil {
+		return "", err
+	}
+	return subPackage.ID, nil
+}
+
 func CreatePayment(stripePayment *stripe.PaymentIntent) error {
 	payment := &repository.Payment{
 		ID:        stripePayment.ID,
@@ -251,8 +275,9 @@ func StripeSubscriptionSync(c *gin.Context) {
 				fmt.Println("Error getting subscription by ID:", err)
 				continue
 			}
-			if dbSubscription.Status != repository.SubscriptionStatus(subscription.Status) {
-				fmt.Println("Subscription status changed:", dbSubscription.Status, "->", repository.SubscriptionStatus(subscription.Status))
+			// Subscriptions stored before packages were tracked get their package on the next sync
+			if dbSubscription.Status != repository.SubscriptionStatus(subscription.Status) || dbSubscription.PackageID == "" {
+				fmt.Println("Subscription changed:", dbSubscription.Status, "->", repository.SubscriptionStatus(subscription.Status))
 				// Send email to user
 				err = UpdateSubscription(subscription)
 				if err != nil {
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/rules"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxVariants is the most destinations a link can rotate across
+const maxVariants = 10
+
+// variantCookieDuration is how long a visitor keeps getting the same variant
+const variantCookieDuration = 30 * 24 * time.Hour
+
+type SaveVariantsRequest struct {
+	Variants []repository.Variant `json:"variants"`
+}
+
+// GetVariants gets the variants of a link owned by the user
+func GetVariants(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	link, ok := ownedLink(c, user, c.Param("id"))
+	if !ok {
+		return
+	}
+	variants, err := repository.GetVariants(link.ID)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, variants)
+}
+
+// SaveVariants replaces the variants of a link owned by the user. The weights are percentages and have to
+// add up to 100, an empty list turns the rotation off so the link goes to its original url again
+func SaveVariants(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request SaveVariantsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	link, ok := ownedLink(c, user, c.Param("id"))
+	if !ok {
+		return
+	}
+	if len(request.Variants) > maxVariants {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A link can have at most " + strconv.Itoa(maxVariants) + " variants"})
+		return
+	}
+	for _, variant := range request.Variants {
+		if !checkDestination(c, "Variant URL", variant.URL) {
+			return
+		}
+		if variant.Weight <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Variant weight must be greater than zero"})
+			return
+		}
+		if len(variant.Name) > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Variant name must be at most 64 characters long"})
+			return
+		}
+	}
+	if len(request.Variants) > 0 && rules.TotalWeight(request.Variants) != 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Variant weights must add up to 100"})
+		return
+	}
+	variants, err := repository.SaveVariants(link.ID, request.Variants)
+	if err == repository.ErrVariantNotFound {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	linkCache.InvalidateVariants(link.ID)
+	c.JSON(http.StatusOK, variants)
+}
+
+// GetVariantStatistics returns the clicks per variant of a link in the given date range
+func GetVariantStatistics(c *gin.Context) {
+	user := c.MustGet("user").(*repository.User)
+	var request StatisticsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	startDate, err := time.Parse(time.RFC3339, request.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start date format"})
+		return
+	}
+	endDate, err := time.Parse(time.RFC3339, request.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end date format"})
+		return
+	}
+	if _, ok := ownedLink(c, user, request.LinkId); !ok {
+		return
+	}
+	stats, err := repository.GetVariantStatistics(request.LinkId, startDate, endDate)
+	if err != nil {
+		fmt.Println(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// chooseVariant returns the variant the visitor is sent to, nil when the link does not rotate its traffic.
+// The assignment is kept in a cookie so returning visitors see the same variant
+func chooseVariant(c *gin.Context, link *repository.Link) *repository.Variant {
+	variants, err := linkCache.Variants(link.ID)
+	if err != nil {
+		fmt.Println(err)
+		return nil
+	}
+	if len(variants) == 0 {
+		return nil
+	}
+	cookieName := variantCookieName(link.ID)
+	if value, err := c.Cookie(cookieName); err == nil {
+		if id, err := strconv.Atoi(value); err == nil {
+			if variant := rules.FindVariant(variants, id); variant != nil {
+				return variant
+			}
+		}
+	}
+	variant := rules.PickVariant(variants, rand.IntN(rules.TotalWeight(variants)))
+	if variant == nil {
+		return nil
+	}
+	c.SetCookie(
+		cookieName,
+		strconv.Itoa(variant.ID),
+		int(variantCookieDuration.Seconds()),
+		"/"+link.ShortId,
+		"",
+		settings.CookieSecure,
+		true, // HttpOnly
+	)
+	return variant
+}
+
+func variantCookieName(linkID int) string {
+	return "link_variant_" + strconv.Itoa(linkID)
+}
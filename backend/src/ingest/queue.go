@@ -0,0 +1,211 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"link-shortener-backend/src/geoip"
+	"link-shortener-backend/src/metrics"
+	"link-shortener-backend/src/repository"
+	"sync"
+	"time"
+)
+
+var (
+	enqueuedClicks = metrics.NewCounter("clicks_enqueued_total", "Clicks accepted into the ingestion queue")
+	droppedClicks  = metrics.NewCounter("clicks_dropped_total", "Clicks dropped because the ingestion queue was full or closed")
+	writtenClicks  = metrics.NewCounter("clicks_written_total", "Clicks written to the database")
+	failedClicks   = metrics.NewCounter("clicks_failed_total", "Clicks lost because writing their batch failed")
+	flushedBatches = metrics.NewCounter("click_batches_flushed_total", "Click batches written to the database")
+)
+
+// Writer stores a batch of clicks
+type Writer interface {
+	WriteClicks(ctx context.Context, clicks []repository.Click) error
+}
+
+// WriterFunc adapts a function to the Writer interface
+type WriterFunc func(ctx context.Context, clicks []repository.Click) error
+
+func (f WriterFunc) WriteClicks(ctx context.Context, clicks []repository.Click) error {
+	return f(ctx, clicks)
+}
+
+// DatabaseWriter writes clicks with repository.WriteClicks
+var DatabaseWriter = WriterFunc(repository.WriteClicks)
+
+type Config struct {
+	// BufferSize is how many clicks can wait in the queue before new ones are dropped
+	BufferSize int
+	// BatchSize is the most clicks written at once, a full batch is flushed immediately
+	BatchSize int
+	// FlushInterval is the longest a click waits in a partial batch
+	FlushInterval time.Duration
+	// Workers is the number of batch writers
+	Workers int
+	// Locator fills in the country, region and city of clicks before they are written, nil leaves them as they are
+	Locator geoip.Locator
+}
+
+// Queue records clicks off the redirect path. Clicks are buffered in memory and written in batches,
+// when the buffer is full new clicks are dropped instead of slowing down redirects
+type Queue struct {
+	config  Config
+	writer  Writer
+	clicks  chan repository.Click
+	closed  chan struct{}
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func NewQueue(config Config, writer Writer) *Queue {
+	if config.BufferSize <= 0 {
+		config.BufferSize = 10000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.Workers <= 0 {
+		config.Workers = 1
+	}
+	queue := &Queue{
+		config: config,
+		writer: writer,
+		clicks: make(chan repository.Click, config.BufferSize),
+		closed: make(chan struct{}),
+	}
+	metrics.NewGauge("click_queue_depth", "Clicks waiting in the ingestion queue", func() int64 {
+		return int64(len(queue.clicks))
+	})
+	return queue
+}
+
+// Start runs the batch writers
+func (q *Queue) Start() {
+	for i := 0; i < q.config.Workers; i++ {
+		q.wg.Add(1)
+		go q.run()
+	}
+}
+
+// Enqueue adds a click without blocking and reports whether it was accepted
+func (q *Queue) Enqueue(click repository.Click) bool {
+	if q == nil {
+		droppedClicks.Inc()
+		return false
+	}
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.stopped {
+		droppedClicks.Inc()
+		return false
+	}
+	select {
+	case q.clicks <- click:
+		enqueuedClicks.Inc()
+		return true
+	default:
+		droppedClicks.Inc()
+		return false
+	}
+}
+
+// Close stops accepting clicks and waits until the buffered clicks are written or the context is done
+func (q *Queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.closed)
+	}
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (q *Queue) run() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(q.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]repository.Click, 0, q.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		q.write(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case click := <-q.clicks:
+			batch = append(batch, click)
+			if len(batch) >= q.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-q.closed:
+			// Drain what is left in the buffer before stopping
+			for {
+				select {
+				case click := <-q.clicks:
+					batch = append(batch, click)
+					if len(batch) >= q.config.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (q *Queue) write(batch []repository.Click) {
+	q.locate(batch)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := q.writer.WriteClicks(ctx, batch)
+	if err != nil {
+		fmt.Println("Error writing clicks:", err)
+		failedClicks.Add(int64(len(batch)))
+		return
+	}
+	writtenClicks.Add(int64(len(batch)))
+	flushedBatches.Inc()
+}
+
+// locate looks up the location of clicks that do not have a country yet
+func (q *Queue) locate(batch []repository.Click) {
+	if q.config.Locator == nil {
+		return
+	}
+	for i := range batch {
+		if batch[i].Country != "" || batch[i].IP == "" {
+			continue
+		}
+		location, err := q.config.Locator.Lookup(batch[i].IP)
+		if err != nil {
+			fmt.Println("Error looking up click location:", err)
+			continue
+		}
+		batch[i].Country = location.Country
+		batch[i].Region = location.Region
+		batch[i].City = location.City
+	}
+}
@@ -0,0 +1,67 @@
+package ingest
+
+import (
+	"context"
+	"link-shortener-backend/src/geoip"
+	"link-shortener-backend/src/repository"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueLocatesClicks(t *testing.T) {
+	data, err := os.ReadFile("../geoip/testdata/city.mmdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database, err := geoip.FromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer database.Close()
+
+	var mu sync.Mutex
+	var written []repository.Click
+	writer := WriterFunc(func(ctx context.Context, clicks []repository.Click) error {
+		mu.Lock()
+		defer mu.Unlock()
+		written = append(written, clicks...)
+		return nil
+	})
+	queue := NewQueue(Config{BatchSize: 10, FlushInterval: time.Millisecond, Locator: database}, writer)
+	queue.Start()
+	clicks := []repository.Click{
+		{LinkID: 1, IP: "203.0.113.7"},
+		// Clicks that already have a country keep their location
+		{LinkID: 2, IP: "203.0.113.7", Country: "NL"},
+		{LinkID: 3, IP: "192.0.2.1"},
+		{LinkID: 4},
+	}
+	for _, click := range clicks {
+		if !queue.Enqueue(click) {
+			t.Fatalf("click %d was dropped", click.LinkID)
+		}
+	}
+	if err := queue.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]geoip.Location{
+		1: {Country: "DE", Region: "Berlin", City: "Berlin"},
+		2: {Country: "NL"},
+		3: {},
+		4: {},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(written) != len(want) {
+		t.Fatalf("%d clicks written, want %d", len(written), len(want))
+	}
+	for _, click := range written {
+		location := geoip.Location{Country: click.Country, Region: click.Region, City: click.City}
+		if location != want[click.LinkID] {
+			t.Errorf("click %d location = %+v, want %+v", click.LinkID, location, want[click.LinkID])
+		}
+	}
+}
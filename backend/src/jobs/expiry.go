@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"time"
+)
+
+// StartExpirySweeper periodically marks links that are past their expiry date or click budget,
+// so the dashboard can list them as expired
+func StartExpirySweeper(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			marked, err := repository.MarkExpiredLinks()
+			if err != nil {
+				fmt.Println("Error marking expired links:", err)
+				continue
+			}
+			if marked > 0 {
+				fmt.Println("Marked", marked, "links as expired")
+			}
+		}
+	}()
+}
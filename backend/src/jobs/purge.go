@@ -0,0 +1,26 @@
+package jobs
+
+import (
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"time"
+)
+
+// StartTrashPurger periodically removes links that have been in the trash for longer than the retention,
+// together with their clicks and redirects. Their short ids become available again afterwards
+func StartTrashPurger(interval time.Duration, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			purged, err := repository.PurgeDeletedLinks(time.Now().Add(-retention))
+			if err != nil {
+				fmt.Println("Error purging deleted links:", err)
+				continue
+			}
+			if purged > 0 {
+				fmt.Println("Purged", purged, "deleted links")
+			}
+		}
+	}()
+}
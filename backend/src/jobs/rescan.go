@@ -0,0 +1,78 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"link-shortener-backend/src/cache"
+	"link-shortener-backend/src/repository"
+	"link-shortener-backend/src/safety"
+	"time"
+)
+
+// rescanBatchSize is how many links are checked per query
+const rescanBatchSize = 500
+
+// StartURLRescan periodically checks the destinations of every active link again, so links to hosts that
+// were blocklisted after they were created get disabled and dropped from the link cache. A reloadable reputation
+// source is reloaded before each pass
+func StartURLRescan(interval time.Duration, checker *safety.Checker, links *cache.Links) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if reloader, ok := checker.Reputation.(interface{ Reload() error }); ok {
+				if err := reloader.Reload(); err != nil {
+					fmt.Println("Error reloading url blocklist:", err)
+				}
+			}
+			disabled, err := rescanLinks(checker, links)
+			if err != nil {
+				fmt.Println("Error rescanning link destinations:", err)
+			}
+			if disabled > 0 {
+				fmt.Println("Disabled", disabled, "links with unsafe destinations")
+			}
+		}
+	}()
+}
+
+func rescanLinks(checker *safety.Checker, linkCache *cache.Links) (int, error) {
+	disabled := 0
+	afterID := 0
+	for {
+		links, err := repository.GetLinkDestinations(afterID, rescanBatchSize)
+		if err != nil {
+			return disabled, err
+		}
+		if len(links) == 0 {
+			return disabled, nil
+		}
+		for _, link := range links {
+			afterID = link.LinkID
+			for _, url := range link.URLs {
+				err := checker.Check(url)
+				if err == nil {
+					continue
+				}
+				// Lookups that failed are tried again on the next pass instead of disabling the link
+				if !safety.Unsafe(err) {
+					fmt.Println("Error checking destination of link", link.LinkID, err)
+					continue
+				}
+				// Links created before destinations were validated may lack a scheme, they are broken but not harmful
+				if errors.Is(err, safety.ErrInvalidURL) {
+					continue
+				}
+				moderated, err := repository.DisableLink(link.LinkID, url+": "+err.Error(), nil)
+				if err != nil {
+					return disabled, err
+				}
+				if moderated != nil {
+					linkCache.InvalidateLink(moderated.ShortId, moderated.DomainID)
+					disabled++
+				}
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Counter is a value that only goes up
+type Counter struct {
+	name  string
+	help  string
+	value atomic.Int64
+}
+
+func (c *Counter) Inc() {
+	c.value.Add(1)
+}
+
+func (c *Counter) Add(n int64) {
+	c.value.Add(n)
+}
+
+func (c *Counter) Value() int64 {
+	return c.value.Load()
+}
+
+type gauge struct {
+	name  string
+	help  string
+	value func() int64
+}
+
+var (
+	counters = map[string]*Counter{}
+	gauges   = map[string]gauge{}
+	mu       sync.Mutex
+)
+
+// NewCounter registers a counter, registering the same name twice returns the existing counter
+func NewCounter(name string, help string) *Counter {
+	mu.Lock()
+	defer mu.Unlock()
+	if counter, ok := counters[name]; ok {
+		return counter
+	}
+	counter := &Counter{name: name, help: help}
+	counters[name] = counter
+	return counter
+}
+
+// NewGauge registers a gauge whose value is read from the function when the metrics are written
+func NewGauge(name string, help string, value func() int64) {
+	mu.Lock()
+	defer mu.Unlock()
+	gauges[name] = gauge{name: name, help: help, value: value}
+}
+
+// Write writes all metrics in the Prometheus text format
+func Write(w io.Writer) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := make([]string, 0, len(counters)+len(gauges))
+	for name := range counters {
+		names = append(names, name)
+	}
+	for name := range gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var err error
+		if counter, ok := counters[name]; ok {
+			_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, counter.help, name, name, counter.Value())
+		} else {
+			g := gauges[name]
+			_, err = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, g.help, name, name, g.value())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package pages
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"html/template"
+	"io"
+)
+
+//go:embed templates/*.html
+var files embed.FS
+
+var templates = template.Must(template.ParseFS(files, "templates/*.html"))
+
+const (
+	Password = "password.html"
+	Upgrade  = "upgrade.html"
+	NotFound = "not_found.html"
+	Paused   = "paused.html"
+	Expired  = "expired.html"
+	Blocked  = "blocked.html"
+)
+
+// Customizable maps the names link owners use for their own templates to the pages they replace.
+// The blocked page is not customizable, it is shown for links disabled for abuse
+var Customizable = map[string]string{
+	"not_found": NotFound,
+	"paused":    Paused,
+	"expired":   Expired,
+}
+
+// CustomName returns the name owners use to replace the page, empty when the page is not customizable
+func CustomName(name string) string {
+	for custom, page := range Customizable {
+		if page == name {
+			return custom
+		}
+	}
+	return ""
+}
+
+// CustomPolicy is the Content-Security-Policy custom templates are served with. Owner markup is served from
+// the same origin as the api, the sandbox without allow-scripts and allow-same-origin keeps it from running
+// scripts, submitting forms or reading the cookies of the origin
+const CustomPolicy = "sandbox"
+
+// maxCustomSize is the largest custom template accepted in bytes
+const maxCustomSize = 64 * 1024
+
+var ErrTemplateTooLarge = errors.New("template must be at most 64 KiB")
+
+// PasswordData is passed to the password page
+type PasswordData struct {
+	ShortId string
+	Error   string
+}
+
+// UpgradeData is passed to the interstitial shown when the link owner is over their click limit
+type UpgradeData struct {
+	Destination string
+}
+
+// LinkData is passed to the not found, paused, expired and blocked pages and to their custom templates
+type LinkData struct {
+	ShortId string
+}
+
+// Render writes the named page to w
+func Render(w io.Writer, name string, data any) error {
+	return templates.ExecuteTemplate(w, name, data)
+}
+
+// ParseCustom parses a template uploaded by a link owner and checks that it renders with LinkData.
+// Custom templates are html/template templates, so values are escaped like in the built in pages
+func ParseCustom(body string) (*template.Template, error) {
+	if len(body) > maxCustomSize {
+		return nil, ErrTemplateTooLarge
+	}
+	custom, err := template.New("custom").Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := custom.Execute(io.Discard, LinkData{ShortId: "example"}); err != nil {
+		return nil, err
+	}
+	return custom, nil
+}
+
+// RenderCustom writes a parsed custom template to w, falling back to the built in page when it does not render
+func RenderCustom(w io.Writer, custom *template.Template, name string, data LinkData) error {
+	// Render into a buffer first so a failing template does not leave half a page behind
+	var buffer bytes.Buffer
+	if err := custom.Execute(&buffer, data); err != nil {
+		return Render(w, name, data)
+	}
+	_, err := buffer.WriteTo(w)
+	return err
+}
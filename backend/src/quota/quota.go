@@ -0,0 +1,191 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"sync"
+	"time"
+)
+
+// OveragePolicy decides what happens to redirects once the owner used up the monthly clicks of their package
+type OveragePolicy string
+
+const (
+	// PolicyUntracked keeps redirecting but stops recording clicks
+	PolicyUntracked OveragePolicy = "untracked"
+	// PolicyInterstitial shows an upgrade page before the visitor can continue
+	PolicyInterstitial OveragePolicy = "interstitial"
+)
+
+var (
+	// ErrLinkLimitReached is returned by the repository, which enforces the limit when links are inserted
+	ErrLinkLimitReached   = repository.ErrLinkLimitReached
+	ErrDomainLimitReached = errors.New("custom domain limit of your package reached")
+)
+
+// Policy is the overage policy applied by Redirect
+var Policy = PolicyUntracked
+
+// ParsePolicy validates an overage policy name, an empty name gives the default policy
+func ParsePolicy(name string) (OveragePolicy, error) {
+	switch OveragePolicy(name) {
+	case "":
+		return PolicyUntracked, nil
+	case PolicyUntracked, PolicyInterstitial:
+		return OveragePolicy(name), nil
+	}
+	return "", fmt.Errorf("unknown click overage policy %q", name)
+}
+
+// EffectivePackage returns the package of the user's active subscription, or the default package when there is none.
+// nil means no package is configured and the user is not limited
+func EffectivePackage(user *repository.User) (*repository.Package, error) {
+	var subscription *repository.Subscription
+	if user.StripeCustomerID != nil {
+		var err error
+		subscription, err = repository.GetSubscriptionByCustomerId(*user.StripeCustomerID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return SubscriptionPackage(subscription)
+}
+
+// SubscriptionPackage returns the package of the subscription when it is active, or the default package.
+// It is EffectivePackage for callers that already loaded the subscription, subscription may be nil
+func SubscriptionPackage(subscription *repository.Subscription) (*repository.Package, error) {
+	if subscription != nil && isActive(subscription.Status) && subscription.PackageID != "" {
+		subPackage, err := repository.GetPackageByID(subscription.PackageID)
+		if err != nil || subPackage != nil {
+			return subPackage, err
+		}
+	}
+	return repository.GetDefaultPackage()
+}
+
+func isActive(status repository.SubscriptionStatus) bool {
+	return status == repository.SubscriptionStatusActive || status == repository.SubscriptionStatusTrialing
+}
+
+// PeriodStart is the start of the calendar month clicks are counted in
+func PeriodStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// UsageFor returns the current usage of the user against the limits of subPackage, the package
+// EffectivePackage resolved for them. A nil package leaves the limits empty
+func UsageFor(userID string, subPackage *repository.Package) (*repository.Usage, error) {
+	periodStart := PeriodStart(time.Now())
+	links, err := repository.CountLinks(userID)
+	if err != nil {
+		return nil, err
+	}
+	clicks, err := repository.CountClicksSince(userID, periodStart)
+	if err != nil {
+		return nil, err
+	}
+	usage := &repository.Usage{
+		Links:         links,
+		MonthlyClicks: clicks,
+		PeriodStart:   periodStart,
+	}
+	if subPackage != nil {
+		usage.MaxLinks = &subPackage.MaxLinks
+		usage.MaxClicks = &subPackage.MaxClicks
+	}
+	return usage, nil
+}
+
+// LinkLimit returns the most links the user may have, -1 when unlimited. The repository enforces it
+// when links are created or restored
+func LinkLimit(user *repository.User) (int, error) {
+	subPackage, err := EffectivePackage(user)
+	if err != nil || subPackage == nil {
+		return -1, err
+	}
+	return subPackage.MaxLinks, nil
+}
+
+// CheckDomainQuota returns ErrDomainLimitReached when the user can not add another custom domain
+func CheckDomainQuota(user *repository.User) error {
+	subPackage, err := EffectivePackage(user)
+	if err != nil {
+		return err
+	}
+	if subPackage == nil {
+		return nil
+	}
+	domains, err := repository.CountDomains(user.ID)
+	if err != nil {
+		return err
+	}
+	if domains >= subPackage.CustomDomains {
+		return ErrDomainLimitReached
+	}
+	return nil
+}
+
+// clickCacheDuration is how long the click overage of a link owner is cached, so redirects
+// do not have to count the monthly clicks every time
+const clickCacheDuration = time.Minute
+
+type clickState struct {
+	exceeded  bool
+	checkedAt time.Time
+}
+
+var (
+	clickStates   = map[string]clickState{}
+	clickStatesMu sync.Mutex
+	// prunedAt is when stale click states were last removed
+	prunedAt time.Time
+)
+
+// fresh reports whether the state can still be used, states expire after clickCacheDuration and when a new period starts
+func (state clickState) fresh(now time.Time) bool {
+	return now.Sub(state.checkedAt) < clickCacheDuration && PeriodStart(state.checkedAt).Equal(PeriodStart(now))
+}
+
+// ClicksExceeded reports whether the owner used up the monthly clicks of their package
+func ClicksExceeded(ownerID string) (bool, error) {
+	now := time.Now()
+	clickStatesMu.Lock()
+	state, ok := clickStates[ownerID]
+	clickStatesMu.Unlock()
+	if ok && state.fresh(now) {
+		return state.exceeded, nil
+	}
+
+	owner, err := repository.GetUserByID(ownerID)
+	if err != nil {
+		return false, err
+	}
+	subPackage, err := EffectivePackage(owner)
+	if err != nil {
+		return false, err
+	}
+	exceeded := false
+	if subPackage != nil {
+		clicks, err := repository.CountClicksSince(ownerID, PeriodStart(now))
+		if err != nil {
+			return false, err
+		}
+		exceeded = clicks >= subPackage.MaxClicks
+	}
+
+	clickStatesMu.Lock()
+	clickStates[ownerID] = clickState{exceeded: exceeded, checkedAt: now}
+	// Owners without recent redirects would otherwise stay in the map forever
+	if now.Sub(prunedAt) >= clickCacheDuration {
+		for id, state := range clickStates {
+			if !state.fresh(now) {
+				delete(clickStates, id)
+			}
+		}
+		prunedAt = now
+	}
+	clickStatesMu.Unlock()
+	return exceeded, nil
+}
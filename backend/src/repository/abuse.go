@@ -0,0 +1,262 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type ReportReason string
+
+const (
+	ReportPhishing ReportReason = "phishing"
+	ReportMalware  ReportReason = "malware"
+	ReportSpam     ReportReason = "spam"
+	ReportIllegal  ReportReason = "illegal"
+	ReportOther    ReportReason = "other"
+)
+
+type ReportStatus string
+
+const (
+	ReportOpen      ReportStatus = "open"
+	ReportActioned  ReportStatus = "actioned"
+	ReportDismissed ReportStatus = "dismissed"
+)
+
+// ReportAction is what an admin does about a report
+type ReportAction string
+
+const (
+	ReportDismiss     ReportAction = "dismiss"
+	ReportDisableLink ReportAction = "disable_link"
+	ReportSuspendUser ReportAction = "suspend_user"
+)
+
+var (
+	ErrReportNotFound = errors.New("report not found")
+	ErrReportResolved = errors.New("report has already been resolved")
+	ErrReportLimit    = errors.New("too many open reports, try again after they were reviewed")
+)
+
+// AbuseReport is a complaint about a link sent by a visitor
+type AbuseReport struct {
+	ID            int          `json:"id"`
+	LinkID        int          `json:"linkId"`
+	Reason        ReportReason `json:"reason"`
+	Details       *string      `json:"details"`
+	ReporterEmail *string      `json:"reporterEmail"`
+	ReporterIP    string       `json:"reporterIp"`
+	Status        ReportStatus `json:"status"`
+	// Decision is the note the admin recorded when resolving the report
+	Decision   *string    `json:"decision"`
+	ResolvedBy *string    `json:"resolvedBy"`
+	ResolvedAt *time.Time `json:"resolvedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// QueuedReport is a report in the admin queue together with the link it is about
+type QueuedReport struct {
+	AbuseReport
+	ShortId    string     `json:"shortId"`
+	Original   string     `json:"original"`
+	LinkStatus LinkStatus `json:"linkStatus"`
+	OwnerID    string     `json:"ownerId"`
+	OwnerEmail string     `json:"ownerEmail"`
+	// OwnerSuspended is whether the owner of the link is suspended
+	OwnerSuspended bool `json:"ownerSuspended"`
+	// OpenReports is how many open reports the link has
+	OpenReports int `json:"openReports"`
+}
+
+const reportColumns = `id, link_id, reason, details, reporter_email, reporter_ip, status, decision, resolved_by, resolved_at, created_at`
+
+func scanReport(row pgx.Row) (AbuseReport, error) {
+	var report AbuseReport
+	err := row.Scan(&report.ID, &report.LinkID, &report.Reason, &report.Details, &report.ReporterEmail, &report.ReporterIP,
+		&report.Status, &report.Decision, &report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt)
+	return report, err
+}
+
+// CreateAbuseReport files a report. A reporter with an open report on the link does not file another one,
+// it reports whether the report was filed. A reporter ip with maxOpen open reports gets ErrReportLimit,
+// so rotating through links does not fill the queue
+func CreateAbuseReport(report AbuseReport, maxOpen int) (bool, error) {
+	query := `
+		INSERT INTO abuse_reports (link_id, reason, details, reporter_email, reporter_ip, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`
+
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Reports of the same ip are filed one after another, so concurrent reports can not go over maxOpen together
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('abuse_reports:' || $1))`, report.ReporterIP); err != nil {
+		return false, err
+	}
+	var open, openOnLink int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE link_id = $2)
+		FROM abuse_reports
+		WHERE reporter_ip = $1 AND status = 'open'
+	`, report.ReporterIP, report.LinkID).Scan(&open, &openOnLink)
+	if err != nil {
+		return false, err
+	}
+	if openOnLink > 0 {
+		return false, nil
+	}
+	if open >= maxOpen {
+		return false, ErrReportLimit
+	}
+
+	var id int
+	err = tx.QueryRow(ctx, query, report.LinkID, report.Reason, report.Details, report.ReporterEmail, report.ReporterIP, report.CreatedAt).Scan(&id)
+	if err != nil {
+		return false, err
+	}
+	details := string(report.Reason)
+	err = createAuditEntry(tx, AuditEntry{
+		Action:     AuditReportCreated,
+		TargetType: AuditTargetReport,
+		TargetID:   strconv.Itoa(id),
+		Details:    &details,
+		CreatedAt:  report.CreatedAt,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// GetAbuseReports gets the reports with the status, oldest first so the queue is worked in order
+func GetAbuseReports(status ReportStatus, limit int) ([]QueuedReport, error) {
+	query := `
+		SELECT r.id, r.link_id, r.reason, r.details, r.reporter_email, r.reporter_ip, r.status, r.decision,
+			r.resolved_by, r.resolved_at, r.created_at,
+			l.short_id, l.original, l.status, u.id, u.email, u.suspended_at IS NOT NULL,
+			(SELECT COUNT(*) FROM abuse_reports o WHERE o.link_id = r.link_id AND o.status = 'open')
+		FROM abuse_reports r
+		JOIN links l ON l.id = r.link_id
+		JOIN users u ON u.id = l.created_by
+		WHERE r.status = $1
+		ORDER BY r.created_at, r.id
+		LIMIT $2
+	`
+
+	rows, err := Db.Query(context.Background(), query, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := make([]QueuedReport, 0)
+	for rows.Next() {
+		var report QueuedReport
+		err := rows.Scan(&report.ID, &report.LinkID, &report.Reason, &report.Details, &report.ReporterEmail, &report.ReporterIP,
+			&report.Status, &report.Decision, &report.ResolvedBy, &report.ResolvedAt, &report.CreatedAt,
+			&report.ShortId, &report.Original, &report.LinkStatus, &report.OwnerID, &report.OwnerEmail, &report.OwnerSuspended,
+			&report.OpenReports)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, rows.Err()
+}
+
+// ResolveAbuseReport carries out the action on an open report and records the decision. Disabling the link
+// or suspending its owner also resolves the other open reports of the link. It returns the resolved report
+// and the links that were disabled
+func ResolveAbuseReport(id int, action ReportAction, decision string, adminID string) (AbuseReport, []ModeratedLink, error) {
+	var resolved AbuseReport
+	links, err := moderate(func(tx pgx.Tx) ([]ModeratedLink, error) {
+		ctx := context.Background()
+		report, err := scanReport(tx.QueryRow(ctx, `SELECT `+reportColumns+` FROM abuse_reports WHERE id = $1 FOR UPDATE`, id))
+		if err == pgx.ErrNoRows {
+			return nil, ErrReportNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if report.Status != ReportOpen {
+			return nil, ErrReportResolved
+		}
+
+		var links []ModeratedLink
+		status := ReportActioned
+		switch action {
+		case ReportDisableLink:
+			links, err = disableLinks(tx, "id = $1", report.LinkID, decision, &adminID)
+		case ReportSuspendUser:
+			var ownerID string
+			err = tx.QueryRow(ctx, `SELECT created_by FROM links WHERE id = $1`, report.LinkID).Scan(&ownerID)
+			if err == nil {
+				_, links, err = suspendUser(tx, ownerID, decision, adminID)
+			}
+		default:
+			status = ReportDismissed
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// Dismissing only resolves this report, an action resolves every open report of the link
+		query := `
+			UPDATE abuse_reports
+			SET status = $2, decision = $3, resolved_by = $4, resolved_at = $5
+			WHERE id = $1 OR ($6 AND link_id = $7 AND status = 'open')
+			RETURNING id
+		`
+		now := time.Now()
+		rows, err := tx.Query(ctx, query, id, status, decision, adminID, now, status == ReportActioned, report.LinkID)
+		if err != nil {
+			return nil, err
+		}
+		var resolvedIDs []int
+		for rows.Next() {
+			var resolvedID int
+			if err := rows.Scan(&resolvedID); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			resolvedIDs = append(resolvedIDs, resolvedID)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		details := string(action) + ": " + decision
+		for _, resolvedID := range resolvedIDs {
+			err := createAuditEntry(tx, AuditEntry{
+				ActorID:    &adminID,
+				Action:     AuditReportResolved,
+				TargetType: AuditTargetReport,
+				TargetID:   strconv.Itoa(resolvedID),
+				Details:    &details,
+				CreatedAt:  now,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		report.Status = status
+		report.Decision = &decision
+		report.ResolvedBy = &adminID
+		report.ResolvedAt = &now
+		resolved = report
+		return links, nil
+	})
+	return resolved, links, err
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type AuditAction string
+
+const (
+	AuditReportCreated   AuditAction = "report_created"
+	AuditReportResolved  AuditAction = "report_resolved"
+	AuditLinkDisabled    AuditAction = "link_disabled"
+	AuditLinkEnabled     AuditAction = "link_enabled"
+	AuditUserSuspended   AuditAction = "user_suspended"
+	AuditUserUnsuspended AuditAction = "user_unsuspended"
+)
+
+type AuditTarget string
+
+const (
+	AuditTargetLink   AuditTarget = "link"
+	AuditTargetUser   AuditTarget = "user"
+	AuditTargetReport AuditTarget = "report"
+)
+
+// AuditEntry records a moderation action. ActorID is nil for actions of visitors and the system
+type AuditEntry struct {
+	ID         int         `json:"id"`
+	ActorID    *string     `json:"actorId"`
+	Action     AuditAction `json:"action"`
+	TargetType AuditTarget `json:"targetType"`
+	TargetID   string      `json:"targetId"`
+	Details    *string     `json:"details"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
+
+func createAuditEntry(db querier, entry AuditEntry) error {
+	query := `
+		INSERT INTO audit_log (actor_id, action, target_type, target_id, details, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := db.Exec(context.Background(), query, entry.ActorID, entry.Action, entry.TargetType, entry.TargetID, entry.Details, entry.CreatedAt)
+	return err
+}
+
+// GetAuditLog gets up to limit entries created before the given time, newest first. An empty target type
+// returns the entries of every target
+func GetAuditLog(targetType AuditTarget, targetID string, before time.Time, limit int) ([]AuditEntry, error) {
+	query := `
+		SELECT id, actor_id, action, target_type, target_id, details, created_at
+		FROM audit_log
+		WHERE created_at < $1 AND ($2 = '' OR (target_type = $2 AND target_id = $3))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`
+
+	rows, err := Db.Query(context.Background(), query, before, targetType, targetID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := make([]AuditEntry, 0)
+	for rows.Next() {
+		var entry AuditEntry
+		err := rows.Scan(&entry.ID, &entry.ActorID, &entry.Action, &entry.TargetType, &entry.TargetID, &entry.Details, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"time"
+	"unicode/utf8"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/mssola/useragent"
@@ -17,13 +18,21 @@ type Click struct {
 	Referer   string    `json:"referer"`
 	IP        string    `json:"ip"`
 	Country   string    `json:"country"`
+	Region    string    `json:"region"`
+	City      string    `json:"city"`
+	// PasswordPassed is set when the visitor unlocked a password protected link
+	PasswordPassed bool `json:"passwordPassed"`
+	// Paused is set for visits while the link was paused, they are left out of the regular statistics
+	Paused bool `json:"paused"`
+	// VariantID is the variant the visitor was sent to on links that rotate their traffic
+	VariantID *int `json:"variantId"`
 }
 
 func CreateClick(click Click) (Click, error) {
 	query := `
-		INSERT INTO clicks (link_id, created_at, user_agent, referer, ip, country)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING id, link_id, created_at, user_agent, referer, ip, country
+		INSERT INTO clicks (link_id, created_at, user_agent, referer, ip, country, region, city, password_passed, paused, variant_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id, link_id, created_at, user_agent, referer, ip, country, region, city, password_passed, paused, variant_id
 	`
 
 	err := Db.QueryRow(
@@ -35,6 +44,11 @@ func CreateClick(click Click) (Click, error) {
 		click.Referer,
 		click.IP,
 		click.Country,
+		click.Region,
+		click.City,
+		click.PasswordPassed,
+		click.Paused,
+		click.VariantID,
 	).Scan(
 		&click.ID,
 		&click.LinkID,
@@ -43,6 +57,11 @@ func CreateClick(click Click) (Click, error) {
 		&click.Referer,
 		&click.IP,
 		&click.Country,
+		&click.Region,
+		&click.City,
+		&click.PasswordPassed,
+		&click.Paused,
+		&click.VariantID,
 	)
 
 	if err != nil {
@@ -52,10 +71,107 @@ func CreateClick(click Click) (Click, error) {
 	return click, nil
 }
 
+// maxClickTextLength is the size of the varchar columns of clicks
+const maxClickTextLength = 255
+
+// maxLocationLength is the size of the region and city columns
+const maxLocationLength = 100
+
+// WriteClicks stores a batch of clicks with COPY and increments the click counts of their links in one transaction.
+// Paused clicks are counted in paused_clicks instead of clicks
+func WriteClicks(ctx context.Context, clicks []Click) error {
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	counts := map[int]int{}
+	pausedCounts := map[int]int{}
+	for _, click := range clicks {
+		if click.Paused {
+			pausedCounts[click.LinkID]++
+		} else {
+			counts[click.LinkID]++
+		}
+	}
+	_, err = tx.CopyFrom(
+		ctx,
+		pgx.Identifier{"clicks"},
+		[]string{"link_id", "created_at", "user_agent", "referer", "ip", "country", "region", "city", "password_passed", "paused", "variant_id"},
+		pgx.CopyFromSlice(len(clicks), func(i int) ([]any, error) {
+			click := clicks[i]
+			return []any{
+				click.LinkID,
+				click.CreatedAt,
+				truncate(click.UserAgent, maxClickTextLength),
+				truncate(click.Referer, maxClickTextLength),
+				truncate(click.IP, 40),
+				truncate(click.Country, 40),
+				truncate(click.Region, maxLocationLength),
+				truncate(click.City, maxLocationLength),
+				click.PasswordPassed,
+				click.Paused,
+				click.VariantID,
+			}, nil
+		}),
+	)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE links
+		SET clicks = links.clicks + counts.increment
+		FROM (SELECT unnest($1::int[]) AS id, unnest($2::int[]) AS increment) counts
+		WHERE links.id = counts.id
+	`
+	if err := incrementCounts(ctx, tx, query, counts); err != nil {
+		return err
+	}
+	query = `
+		UPDATE links
+		SET paused_clicks = links.paused_clicks + counts.increment
+		FROM (SELECT unnest($1::int[]) AS id, unnest($2::int[]) AS increment) counts
+		WHERE links.id = counts.id
+	`
+	if err := incrementCounts(ctx, tx, query, pausedCounts); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// incrementCounts runs a counter update with the link ids and increments as arrays
+func incrementCounts(ctx context.Context, db querier, query string, counts map[int]int) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	linkIDs := make([]int32, 0, len(counts))
+	increments := make([]int32, 0, len(counts))
+	for linkID, count := range counts {
+		linkIDs = append(linkIDs, int32(linkID))
+		increments = append(increments, int32(count))
+	}
+	_, err := db.Exec(ctx, query, linkIDs, increments)
+	return err
+}
+
+// truncate shortens a string to at most max bytes without splitting a character
+func truncate(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	for max > 0 && !utf8.RuneStart(value[max]) {
+		max--
+	}
+	return value[:max]
+}
+
 // GetClicks gets all clicks for a link
 func GetClicks(linkId string) ([]Click, error) {
 	query := `
-		SELECT id, link_id, created_at, user_agent, referer, ip, country
+		SELECT id, link_id, created_at, user_agent, referer, ip, country, region, city, password_passed, paused, variant_id
 		FROM clicks
 		WHERE link_id = $1
 	`
@@ -77,6 +193,11 @@ func GetClicks(linkId string) ([]Click, error) {
 			&click.Referer,
 			&click.IP,
 			&click.Country,
+			&click.Region,
+			&click.City,
+			&click.PasswordPassed,
+			&click.Paused,
+			&click.VariantID,
 		)
 		if err != nil {
 			return []Click{}, err
@@ -87,6 +208,20 @@ func GetClicks(linkId string) ([]Click, error) {
 	return clicks, nil
 }
 
+// CountClicksSince counts the clicks on all links of the user since the given time
+func CountClicksSince(userId string, since time.Time) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM clicks
+		INNER JOIN links ON links.id = clicks.link_id
+		WHERE links.created_by = $1 AND clicks.created_at >= $2 AND NOT clicks.paused
+	`
+
+	var count int
+	err := Db.QueryRow(context.Background(), query, userId, since).Scan(&count)
+	return count, err
+}
+
 type DailyStatistics struct {
 	Date  time.Time `json:"date"`
 	Count int       `json:"count"`
@@ -107,23 +242,26 @@ type DeviceStatistics struct {
 type TotalStatsResponse struct {
 	TotalLinks  int `json:"totalLinks"`
 	TotalClicks int `json:"totalClicks"`
+	// TotalPausedClicks are the visits to links while they were paused
+	TotalPausedClicks int `json:"totalPausedClicks"`
 }
 
 func GetTotalStats(userId string) (*TotalStatsResponse, error) {
 	query := `
-		SELECT COUNT(*) as total_links, COALESCE(SUM(clicks), 0) as total_clicks
+		SELECT COUNT(*) as total_links, COALESCE(SUM(clicks), 0) as total_clicks, COALESCE(SUM(paused_clicks), 0) as total_paused_clicks
 		FROM links
-		WHERE created_by = $1
+		WHERE created_by = $1 AND deleted_at IS NULL
 	`
 
 	var totalLinkCount int
 	var totalClickCount int
-	err := Db.QueryRow(context.Background(), query, userId).Scan(&totalLinkCount, &totalClickCount)
+	var totalPausedClickCount int
+	err := Db.QueryRow(context.Background(), query, userId).Scan(&totalLinkCount, &totalClickCount, &totalPausedClickCount)
 	if err != nil {
 		return nil, err
 	}
 
-	return &TotalStatsResponse{TotalLinks: totalLinkCount, TotalClicks: totalClickCount}, nil
+	return &TotalStatsResponse{TotalLinks: totalLinkCount, TotalClicks: totalClickCount, TotalPausedClicks: totalPausedClickCount}, nil
 }
 
 // Daily statistics for the whole account, grouped by day
@@ -132,7 +270,7 @@ func GetDailyStatistics(userId string, startDate time.Time, endDate time.Time) (
 		SELECT DATE(clicks.created_at) as date, COUNT(*) as count
 		FROM clicks
 		INNER JOIN links ON links.id = clicks.link_id
-		WHERE links.created_by = $1 AND clicks.created_at BETWEEN $2 AND $3
+		WHERE links.created_by = $1 AND clicks.created_at BETWEEN $2 AND $3 AND NOT clicks.paused
 		GROUP BY DATE(clicks.created_at)
 		ORDER BY date
 	`
@@ -163,7 +301,7 @@ func GetClicksByDateRange(linkId string, startDate time.Time, endDate time.Time)
 	query := `
 		SELECT DATE(created_at) as date, COUNT(*) as count
 		FROM clicks
-		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3
+		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3 AND NOT paused
 		GROUP BY DATE(created_at)
 		ORDER BY date
 	`
@@ -188,7 +326,7 @@ func GetClicksByDateRange(linkId string, startDate time.Time, endDate time.Time)
 }
 
 func GetDeviceStatistics(userId string, linkId string, startDate time.Time, endDate time.Time) ([]DeviceStatistics, error) {
-	query := `SELECT user_agent FROM clicks WHERE link_id = $1 AND created_at BETWEEN $2 AND $3`
+	query := `SELECT user_agent FROM clicks WHERE link_id = $1 AND created_at BETWEEN $2 AND $3 AND NOT paused`
 
 	rows, err := Db.Query(context.Background(), query, linkId, startDate, endDate)
 	var deviceStatistics []DeviceStatistics = make([]DeviceStatistics, 0)
@@ -232,7 +370,7 @@ func GetRefererStatistics(linkId string, startDate time.Time, endDate time.Time)
 	query := `
 		SELECT referer, COUNT(*) as count
 		FROM clicks
-		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3
+		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3 AND NOT paused
 		GROUP BY referer
 		ORDER BY count DESC
 	`
@@ -269,7 +407,7 @@ func GetIpStatistics(linkId string, startDate time.Time, endDate time.Time) ([]I
 	query := `
 		SELECT ip, COUNT(*) as count
 		FROM clicks
-		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3
+		WHERE link_id = $1 AND created_at BETWEEN $2 AND $3 AND NOT paused
 		GROUP BY ip
 		ORDER BY count DESC
 	`
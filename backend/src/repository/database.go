@@ -4,21 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"os"
 
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/joho/godotenv"
 )
 
 var Db *pgxpool.Pool
 
-func InitDatabase() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
-	poolConfig, err := pgxpool.ParseConfig(os.Getenv("DATABASE_URL"))
+func InitDatabase(databaseURL string) {
+	poolConfig, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		log.Fatalf("Unable to parse database URL: %v\n", err)
 	}
@@ -0,0 +1,58 @@
+package repository
+
+import "context"
+
+// LinkDestinations are all urls a link can send visitors to: the original, fallback and paused urls and
+// the urls of its redirect rules and variants
+type LinkDestinations struct {
+	LinkID int
+	URLs   []string
+}
+
+// GetLinkDestinations gets the destinations of up to limit links with an id above afterID, in id order.
+// Deleted and disabled links are skipped, they send nobody anywhere
+func GetLinkDestinations(afterID int, limit int) ([]LinkDestinations, error) {
+	query := `
+		WITH batch AS (
+			SELECT id, original, fallback_url, paused_url
+			FROM links
+			WHERE id > $1 AND deleted_at IS NULL AND status <> $3
+			ORDER BY id
+			LIMIT $2
+		)
+		SELECT id, url FROM (
+			SELECT id, original AS url FROM batch
+			UNION ALL
+			SELECT id, fallback_url FROM batch WHERE fallback_url IS NOT NULL
+			UNION ALL
+			SELECT id, paused_url FROM batch WHERE paused_url IS NOT NULL
+			UNION ALL
+			SELECT redirects.link_id, redirects.redirect_url FROM redirects JOIN batch ON batch.id = redirects.link_id
+			UNION ALL
+			SELECT link_variants.link_id, link_variants.url FROM link_variants JOIN batch ON batch.id = link_variants.link_id
+		) destinations
+		ORDER BY id
+	`
+
+	rows, err := Db.Query(context.Background(), query, afterID, limit, LinkDisabled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []LinkDestinations
+	for rows.Next() {
+		var linkID int
+		var url string
+		if err := rows.Scan(&linkID, &url); err != nil {
+			return nil, err
+		}
+		if len(links) == 0 || links[len(links)-1].LinkID != linkID {
+			links = append(links, LinkDestinations{LinkID: linkID})
+		}
+		last := &links[len(links)-1]
+		last.URLs = append(last.URLs, url)
+	}
+
+	return links, rows.Err()
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Domain is a custom domain a user serves their links from
+type Domain struct {
+	ID                int        `json:"id"`
+	UserID            string     `json:"userId"`
+	Hostname          string     `json:"hostname"`
+	VerificationToken string     `json:"verificationToken"`
+	VerifiedAt        *time.Time `json:"verifiedAt"`
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+const domainColumns = `id, user_id, hostname, verification_token, verified_at, created_at`
+
+func scanDomain(row pgx.Row) (Domain, error) {
+	var domain Domain
+	err := row.Scan(&domain.ID, &domain.UserID, &domain.Hostname, &domain.VerificationToken, &domain.VerifiedAt, &domain.CreatedAt)
+	return domain, err
+}
+
+func queryDomain(query string, args ...any) (*Domain, error) {
+	domain, err := scanDomain(Db.QueryRow(context.Background(), query, args...))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &domain, nil
+}
+
+// CreateDomain adds an unverified domain, ErrDomainTaken is returned when the hostname is already verified
+// by an account or registered by the user. Unverified registrations of other accounts do not block it
+func CreateDomain(domain Domain) (Domain, error) {
+	query := `
+		INSERT INTO domains (user_id, hostname, verification_token, created_at)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (SELECT 1 FROM domains WHERE hostname = $2 AND verified_at IS NOT NULL)
+		RETURNING ` + domainColumns
+
+	created, err := scanDomain(Db.QueryRow(context.Background(), query, domain.UserID, domain.Hostname, domain.VerificationToken, domain.CreatedAt))
+	if err == pgx.ErrNoRows || isUniqueViolation(err) {
+		return Domain{}, ErrDomainTaken
+	}
+	return created, err
+}
+
+func GetDomain(id string) (*Domain, error) {
+	query := `
+		SELECT ` + domainColumns + ` FROM domains WHERE id = $1
+	`
+
+	return queryDomain(query, id)
+}
+
+// GetVerifiedDomainByHostname gets the domain links are served from for the request host
+func GetVerifiedDomainByHostname(hostname string) (*Domain, error) {
+	query := `
+		SELECT ` + domainColumns + ` FROM domains WHERE hostname = $1 AND verified_at IS NOT NULL
+	`
+
+	return queryDomain(query, hostname)
+}
+
+func GetDomainsByUser(userID string) ([]Domain, error) {
+	query := `
+		SELECT ` + domainColumns + ` FROM domains WHERE user_id = $1 ORDER BY id
+	`
+
+	var domains []Domain = make([]Domain, 0)
+	rows, err := Db.Query(context.Background(), query, userID)
+	if err != nil {
+		return domains, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return domains, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+func CountDomains(userID string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM domains WHERE user_id = $1
+	`
+
+	var count int
+	err := Db.QueryRow(context.Background(), query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkDomainVerified claims the hostname for the domain, ErrDomainTaken is returned when another
+// account verified it first
+func MarkDomainVerified(id int, verifiedAt time.Time) error {
+	query := `
+		UPDATE domains SET verified_at = $2 WHERE id = $1
+	`
+
+	_, err := Db.Exec(context.Background(), query, id, verifiedAt)
+	if isUniqueViolation(err) {
+		return ErrDomainTaken
+	}
+	return err
+}
+
+// DeleteDomain removes a domain of the user, ErrDomainInUse is returned while links still use it
+func DeleteDomain(id string, userID string) error {
+	query := `
+		DELETE FROM domains WHERE id = $1 AND user_id = $2
+	`
+
+	_, err := Db.Exec(context.Background(), query, id, userID)
+	if isForeignKeyViolation(err) {
+		return ErrDomainInUse
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type HistoryEvent string
+
+const (
+	HistoryDestinationChanged HistoryEvent = "destination_changed"
+	HistoryAliasChanged       HistoryEvent = "alias_changed"
+	HistoryPaused             HistoryEvent = "paused"
+	HistoryResumed            HistoryEvent = "resumed"
+	HistoryDeleted            HistoryEvent = "deleted"
+	HistoryRestored           HistoryEvent = "restored"
+	// HistoryDisabled and HistoryEnabled record the reason of the moderation in their new value
+	HistoryDisabled HistoryEvent = "disabled"
+	HistoryEnabled  HistoryEvent = "enabled"
+)
+
+// LinkHistory is an audit entry for a change made to a link
+type LinkHistory struct {
+	ID        int          `json:"id"`
+	LinkID    int          `json:"linkId"`
+	Event     HistoryEvent `json:"event"`
+	OldValue  *string      `json:"oldValue"`
+	NewValue  *string      `json:"newValue"`
+	CreatedBy *string      `json:"createdBy"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// querier is implemented by both the connection pool and transactions
+type querier interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// createLinkHistory records a single change made to a link, in the transaction of the change
+func createLinkHistory(db querier, entry LinkHistory) error {
+	query := `
+		INSERT INTO link_history (link_id, event, old_value, new_value, created_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
+	_, err := db.Exec(context.Background(), query, entry.LinkID, entry.Event, entry.OldValue, entry.NewValue, entry.CreatedBy, entry.CreatedAt)
+	return err
+}
+
+// GetLinkHistory gets the changes made to a link, newest first
+func GetLinkHistory(linkID string) ([]LinkHistory, error) {
+	query := `
+		SELECT id, link_id, event, old_value, new_value, created_by, created_at
+		FROM link_history
+		WHERE link_id = $1
+		ORDER BY created_at DESC, id DESC
+	`
+
+	var history []LinkHistory = make([]LinkHistory, 0)
+	rows, err := Db.Query(context.Background(), query, linkID)
+	if err != nil {
+		return history, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry LinkHistory
+		err := rows.Scan(&entry.ID, &entry.LinkID, &entry.Event, &entry.OldValue, &entry.NewValue, &entry.CreatedBy, &entry.CreatedAt)
+		if err != nil {
+			return history, err
+		}
+		history = append(history, entry)
+	}
+
+	return history, rows.Err()
+}
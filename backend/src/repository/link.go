@@ -2,38 +2,73 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"link-shortener-backend/src/shortid"
 	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 type Link struct {
-	ID        int       `json:"id,omitempty"`
-	ShortId   string    `json:"shortId"`
-	Original  string    `json:"original"`
-	Short     string    `json:"short,omitempty"`
-	CreatedAt time.Time `json:"createdAt,omitempty"`
-	CreatedBy string    `json:"createdBy,omitempty"`
-	Clicks    int       `json:"clicks"`
+	ID          int        `json:"id,omitempty"`
+	ShortId     string     `json:"shortId"`
+	Original    string     `json:"original"`
+	Short       string     `json:"short,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt,omitempty"`
+	CreatedBy   string     `json:"createdBy,omitempty"`
+	Clicks      int        `json:"clicks"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	MaxClicks   *int       `json:"maxClicks"`
+	FallbackURL *string    `json:"fallbackURL"`
+	ExpiredAt   *time.Time `json:"expiredAt"` // Set by the expiry sweeper once the link stopped redirecting
+	// PasswordHash is the bcrypt hash of the link password, visitors have to enter it before being redirected
+	PasswordHash *string    `json:"-"`
+	Protected    bool       `json:"protected"`
+	Title        *string    `json:"title"`
+	Tags         []string   `json:"tags"`
+	DomainID     *int       `json:"domainId"` // nil for links on the default domain
+	Status       LinkStatus `json:"status"`
+	// PausedURL is where visitors of the link are sent while it is paused, the paused page is shown when it is nil
+	PausedURL *string `json:"pausedURL"`
+	// PausedClicks counts the visits while the link was paused, they are not part of Clicks
+	PausedClicks int `json:"pausedClicks"`
+	// DeletedAt is set while the link is in the trash, it can be restored until the purge job removes it
+	DeletedAt *time.Time `json:"deletedAt"`
+	// ForwardQuery appends the query string of the short link to the destination
+	ForwardQuery bool `json:"forwardQuery"`
 }
 
-// CreateLink creates a new link in the database
-func CreateLink(link Link) (Link, error) {
-	query := `
-		INSERT INTO links (original, short, created_at, created_by, clicks, short_id)
-		VALUES ($1, $2, $3, $4, 0, $5)
-		RETURNING id, original, short, created_at, created_by, clicks, short_id
-	`
+type LinkStatus string
 
-	err := Db.QueryRow(
-		context.Background(),
-		query,
-		link.Original,
-		link.Short,
-		link.CreatedAt,
-		link.CreatedBy,
-		link.ShortId,
-	).Scan(
+const (
+	LinkActive LinkStatus = "active"
+	// LinkPaused links are temporarily switched off by their owner
+	LinkPaused LinkStatus = "paused"
+	// LinkDisabled links were blocked for abuse and can only be enabled again by an admin
+	LinkDisabled LinkStatus = "disabled"
+)
+
+// IsExpired reports whether the link is past its expiry date or has used up its click budget
+func (link *Link) IsExpired(now time.Time) bool {
+	if link.ExpiredAt != nil {
+		return true
+	}
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return true
+	}
+	if link.MaxClicks != nil && link.Clicks >= *link.MaxClicks {
+		return true
+	}
+	return false
+}
+
+// linkColumns is the column list matching scanLink
+const linkColumns = `id, original, short, created_at, created_by, clicks, short_id, expires_at, max_clicks, fallback_url, expired_at, password_hash, title, tags, domain_id, status, paused_url, paused_clicks, deleted_at, forward_query`
+
+func scanLink(row pgx.Row) (Link, error) {
+	var link Link
+	err := row.Scan(
 		&link.ID,
 		&link.Original,
 		&link.Short,
@@ -41,47 +76,446 @@ func CreateLink(link Link) (Link, error) {
 		&link.CreatedBy,
 		&link.Clicks,
 		&link.ShortId,
+		&link.ExpiresAt,
+		&link.MaxClicks,
+		&link.FallbackURL,
+		&link.ExpiredAt,
+		&link.PasswordHash,
+		&link.Title,
+		&link.Tags,
+		&link.DomainID,
+		&link.Status,
+		&link.PausedURL,
+		&link.PausedClicks,
+		&link.DeletedAt,
+		&link.ForwardQuery,
 	)
+	link.Protected = link.PasswordHash != nil
+	return link, err
+}
 
+func queryLinks(query string, args ...any) ([]Link, error) {
+	var links []Link = make([]Link, 0)
+	rows, err := Db.Query(context.Background(), query, args...)
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return links, err
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+var (
+	ErrShortIdTaken     = errors.New("short id is already taken")
+	ErrShortIdExhausted = errors.New("could not generate a unique short id")
+	ErrDomainTaken      = errors.New("domain is already registered")
+	ErrDomainInUse      = errors.New("domain is still used by links")
+	ErrLinkLimitReached = errors.New("link limit of your package reached")
+)
+
+// ShortIds generates the short id of links that are created without a custom alias
+var ShortIds shortid.Generator = shortid.NewRandom(6)
+
+// maxShortIdAttempts is how many generated ids are tried before giving up
+const maxShortIdAttempts = 8
+
+// CreateLink creates a new link in the database. When link.ShortId is empty an id is generated
+// and regenerated on collision, otherwise ErrShortIdTaken is returned if the id is in use.
+// The short url is built from the domain and the final short id. maxLinks is the most links the owner
+// may have or -1 for no limit, ErrLinkLimitReached is returned when the owner already has that many
+func CreateLink(link Link, domain string, maxLinks int) (Link, error) {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
 	if err != nil {
 		return Link{}, err
 	}
+	defer tx.Rollback(ctx)
 
-	return link, nil
+	remaining, err := remainingLinks(tx, link.CreatedBy, maxLinks)
+	if err != nil {
+		return Link{}, err
+	}
+	if remaining == 0 {
+		return Link{}, ErrLinkLimitReached
+	}
+	created, err := insertLink(tx, link, domain)
+	if err != nil {
+		return Link{}, err
+	}
+
+	return created, tx.Commit(ctx)
+}
+
+// remainingLinks locks the user row, so concurrent creates and restores of the user run one after another
+// and can not go over maxLinks together. It returns how many more links the user may have, -1 when maxLinks is -1
+func remainingLinks(db querier, userID string, maxLinks int) (int, error) {
+	if maxLinks < 0 {
+		return -1, nil
+	}
+	ctx := context.Background()
+	if _, err := db.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return 0, err
+	}
+	var count int
+	err := db.QueryRow(ctx, `SELECT COUNT(*) FROM links WHERE created_by = $1 AND deleted_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return max(maxLinks-count, 0), nil
 }
 
-func DeleteLink(id string, userID string) error {
+// CreateLinks creates many links in a single transaction. Every link is inserted in its own savepoint,
+// so a failing row is reported in the returned errors at the same index without aborting the others.
+// All links need the same owner, rows past the owner's maxLinks fail with ErrLinkLimitReached
+func CreateLinks(links []Link, domain string, maxLinks int) ([]Link, []error, error) {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	created := make([]Link, len(links))
+	errs := make([]error, len(links))
+	if len(links) == 0 {
+		return created, errs, nil
+	}
+	remaining, err := remainingLinks(tx, links[0].CreatedBy, maxLinks)
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, link := range links {
+		if remaining == 0 {
+			errs[i] = ErrLinkLimitReached
+			continue
+		}
+		savepoint, err := tx.Begin(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		created[i], errs[i] = insertLink(savepoint, link, domain)
+		if errs[i] != nil {
+			err = savepoint.Rollback(ctx)
+		} else {
+			err = savepoint.Commit(ctx)
+			if remaining > 0 {
+				remaining--
+			}
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return created, errs, tx.Commit(ctx)
+}
+
+func insertLink(db querier, link Link, domain string) (Link, error) {
 	query := `
-		DELETE FROM links
-		WHERE id = $1 AND created_by = $2
+		INSERT INTO links (id, original, short, created_at, created_by, clicks, short_id, expires_at, max_clicks, fallback_url, password_hash, title, tags, domain_id, forward_query)
+		VALUES ($1, $2, $3, $4, $5, 0, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT DO NOTHING
+		RETURNING ` + linkColumns
+
+	custom := link.ShortId != ""
+	for attempt := 0; attempt < maxShortIdAttempts; attempt++ {
+		var id int64
+		err := db.QueryRow(context.Background(), `SELECT nextval(pg_get_serial_sequence('links', 'id'))`).Scan(&id)
+		if err != nil {
+			return Link{}, err
+		}
+
+		shortId := link.ShortId
+		if !custom {
+			shortId, err = ShortIds.Generate(id, attempt)
+			if err != nil {
+				return Link{}, err
+			}
+		}
+
+		created, err := scanLink(db.QueryRow(
+			context.Background(),
+			query,
+			id,
+			link.Original,
+			domain+shortId,
+			link.CreatedAt,
+			link.CreatedBy,
+			shortId,
+			link.ExpiresAt,
+			link.MaxClicks,
+			link.FallbackURL,
+			link.PasswordHash,
+			link.Title,
+			tags(link.Tags),
+			link.DomainID,
+			link.ForwardQuery,
+		))
+		if err == pgx.ErrNoRows {
+			if custom {
+				return Link{}, ErrShortIdTaken
+			}
+			continue
+		}
+		if err != nil {
+			return Link{}, err
+		}
+
+		return created, nil
+	}
+
+	return Link{}, ErrShortIdExhausted
+}
+
+// UpdateLink saves the editable fields of a link and records changes to the destination
+// and alias in the link history within the same transaction
+func UpdateLink(previous Link, link Link, domain string, changedBy string) (Link, error) {
+	query := `
+		UPDATE links
+		SET original = $2, short_id = $3, short = $4, title = $5, tags = $6, expires_at = $7, max_clicks = $8,
+			fallback_url = $9, password_hash = $10, forward_query = $11, expired_at = NULL
+		WHERE id = $1
+		RETURNING ` + linkColumns
+
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return Link{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	updated, err := scanLink(tx.QueryRow(
+		ctx,
+		query,
+		previous.ID,
+		link.Original,
+		link.ShortId,
+		domain+link.ShortId,
+		link.Title,
+		tags(link.Tags),
+		link.ExpiresAt,
+		link.MaxClicks,
+		link.FallbackURL,
+		link.PasswordHash,
+		link.ForwardQuery,
+	))
+	if isUniqueViolation(err) {
+		return Link{}, ErrShortIdTaken
+	}
+	if err != nil {
+		return Link{}, err
+	}
+
+	now := time.Now()
+	if previous.Original != updated.Original {
+		err = createLinkHistory(tx, LinkHistory{
+			LinkID:    updated.ID,
+			Event:     HistoryDestinationChanged,
+			OldValue:  &previous.Original,
+			NewValue:  &updated.Original,
+			CreatedBy: &changedBy,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return Link{}, err
+		}
+	}
+	if previous.ShortId != updated.ShortId {
+		err = createLinkHistory(tx, LinkHistory{
+			LinkID:    updated.ID,
+			Event:     HistoryAliasChanged,
+			OldValue:  &previous.ShortId,
+			NewValue:  &updated.ShortId,
+			CreatedBy: &changedBy,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return Link{}, err
+		}
+	}
+
+	return updated, tx.Commit(ctx)
+}
+
+// SetLinkStatus pauses or resumes a link and records the change in the link history.
+// pausedURL is only kept while the link is paused
+func SetLinkStatus(previous Link, status LinkStatus, pausedURL *string, changedBy string) (Link, error) {
+	query := `
+		UPDATE links
+		SET status = $2, paused_url = $3
+		WHERE id = $1
+		RETURNING ` + linkColumns
+
+	if status != LinkPaused {
+		pausedURL = nil
+	}
+
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return Link{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	updated, err := scanLink(tx.QueryRow(ctx, query, previous.ID, status, pausedURL))
+	if err != nil {
+		return Link{}, err
+	}
+
+	if previous.Status != updated.Status {
+		event := HistoryResumed
+		if updated.Status == LinkPaused {
+			event = HistoryPaused
+		}
+		oldValue := string(previous.Status)
+		newValue := string(updated.Status)
+		err = createLinkHistory(tx, LinkHistory{
+			LinkID:    updated.ID,
+			Event:     event,
+			OldValue:  &oldValue,
+			NewValue:  &newValue,
+			CreatedBy: &changedBy,
+			CreatedAt: time.Now(),
+		})
+		if err != nil {
+			return Link{}, err
+		}
+	}
+
+	return updated, tx.Commit(ctx)
+}
+
+// tags makes sure a missing tag list is stored as an empty array
+func tags(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
+
+// DeleteLink moves a link of the user to the trash. The row is kept, so clicks, redirects and the short id
+// survive until PurgeDeletedLinks removes it. It returns false when the user has no such link
+func DeleteLink(id string, userID string) (bool, error) {
+	query := `
+		UPDATE links
+		SET deleted_at = NOW()
+		WHERE id = $1 AND created_by = $2 AND deleted_at IS NULL
+		RETURNING id
 	`
 
-	_, err := Db.Exec(context.Background(), query, id, userID)
+	err := setDeleted(query, HistoryDeleted, -1, id, userID)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// RestoreLink takes a link of the user out of the trash if it was deleted after the given time.
+// It returns false when there is no such link and ErrLinkLimitReached when the user has maxLinks links already
+func RestoreLink(id string, userID string, deletedAfter time.Time, maxLinks int) (bool, error) {
+	query := `
+		UPDATE links
+		SET deleted_at = NULL
+		WHERE id = $1 AND created_by = $2 AND deleted_at > $3
+		RETURNING id
+	`
+
+	err := setDeleted(query, HistoryRestored, maxLinks, id, userID, deletedAfter)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func setDeleted(query string, event HistoryEvent, maxLinks int, id string, userID string, args ...any) error {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	remaining, err := remainingLinks(tx, userID, maxLinks)
+	if err != nil {
+		return err
+	}
+	if remaining == 0 {
+		return ErrLinkLimitReached
+	}
+
+	var linkID int
+	err = tx.QueryRow(ctx, query, append([]any{id, userID}, args...)...).Scan(&linkID)
+	if err != nil {
+		return err
+	}
+	err = createLinkHistory(tx, LinkHistory{
+		LinkID:    linkID,
+		Event:     event,
+		CreatedBy: &userID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-func GetLinkByShortId(shortId string) (*Link, error) {
+// GetDeletedLinks gets the links of the user that are in the trash, most recently deleted first
+func GetDeletedLinks(userID string) ([]Link, error) {
 	query := `
-		SELECT id, original, short, created_at, created_by, clicks, short_id
+		SELECT ` + linkColumns + `
 		FROM links
-		WHERE short_id = $1
+		WHERE created_by = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC
 	`
 
-	var link Link
-	err := Db.QueryRow(context.Background(), query, shortId).Scan(
-		&link.ID,
-		&link.Original,
-		&link.Short,
-		&link.CreatedAt,
-		&link.CreatedBy,
-		&link.Clicks,
-		&link.ShortId,
-	)
+	return queryLinks(query, userID)
+}
+
+// PurgeDeletedLinks permanently removes the links deleted before the given time together with their clicks
+// and redirects, and returns how many links were removed
+func PurgeDeletedLinks(deletedBefore time.Time) (int64, error) {
+	query := `
+		DELETE FROM links
+		WHERE deleted_at IS NOT NULL AND deleted_at <= $1
+	`
 
+	tag, err := Db.Exec(context.Background(), query, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// GetLinkByShortId gets the link with the short id on the given domain, a nil domain is the default domain
+func GetLinkByShortId(shortId string, domainID *int) (*Link, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM links
+		WHERE short_id = $1 AND COALESCE(domain_id, 0) = COALESCE($2, 0) AND deleted_at IS NULL
+	`
+
+	link, err := scanLink(Db.QueryRow(context.Background(), query, shortId, domainID))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -92,24 +526,40 @@ func GetLinkByShortId(shortId string) (*Link, error) {
 	return &link, nil
 }
 
+// ShortIdExists reports whether a link on the domain already uses the given short id, deleted links included
+func ShortIdExists(shortId string, domainID *int) (bool, error) {
+	query := `
+		SELECT EXISTS(SELECT 1 FROM links WHERE short_id = $1 AND COALESCE(domain_id, 0) = COALESCE($2, 0))
+	`
+
+	var exists bool
+	err := Db.QueryRow(context.Background(), query, shortId, domainID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// CountLinks returns how many links the user has, links in the trash are not counted
+func CountLinks(userID string) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM links WHERE created_by = $1 AND deleted_at IS NULL
+	`
+
+	var count int
+	err := Db.QueryRow(context.Background(), query, userID).Scan(&count)
+	return count, err
+}
+
 func GetLink(id string) (*Link, error) {
 	query := `
-		SELECT id, original, short, created_at, created_by, clicks, short_id
+		SELECT ` + linkColumns + `
 		FROM links
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	var link Link
-	err := Db.QueryRow(context.Background(), query, id).Scan(
-		&link.ID,
-		&link.Original,
-		&link.Short,
-		&link.CreatedAt,
-		&link.CreatedBy,
-		&link.Clicks,
-		&link.ShortId,
-	)
-
+	link, err := scanLink(Db.QueryRow(context.Background(), query, id))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -122,75 +572,55 @@ func GetLink(id string) (*Link, error) {
 
 func GetAllLinks(userID string) ([]Link, error) {
 	query := `
-		SELECT id, original, short, created_at, created_by, clicks, short_id
+		SELECT ` + linkColumns + `
 		FROM links
-		WHERE created_by = $1
+		WHERE created_by = $1 AND deleted_at IS NULL
 		ORDER BY id DESC
 	`
 
-	var links []Link = make([]Link, 0)
-	rows, err := Db.Query(context.Background(), query, userID)
-
-	if err != nil {
-		return links, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.Original,
-			&link.Short,
-			&link.CreatedAt,
-			&link.CreatedBy,
-			&link.Clicks,
-			&link.ShortId,
-		)
-		if err != nil {
-			return links, err
-		}
-		links = append(links, link)
-	}
-
-	return links, nil
+	return queryLinks(query, userID)
 }
 
 func GetRecentLinks(userID string) ([]Link, error) {
 	query := `
-		SELECT id, original, short, created_at, created_by, clicks, short_id
+		SELECT ` + linkColumns + `
 		FROM links
-		WHERE created_by = $1
+		WHERE created_by = $1 AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT 10
 	`
 
-	var links []Link = make([]Link, 0)
-	rows, err := Db.Query(context.Background(), query, userID)
-	if err != nil {
-		return links, err
-	}
-	defer rows.Close()
+	return queryLinks(query, userID)
+}
 
-	for rows.Next() {
-		var link Link
-		err := rows.Scan(
-			&link.ID,
-			&link.Original,
-			&link.Short,
-			&link.CreatedAt,
-			&link.CreatedBy,
-			&link.Clicks,
-			&link.ShortId,
-		)
-		if err != nil {
-			return links, err
-		}
-		links = append(links, link)
-	}
+// GetExpiredLinks gets the links of the user that the expiry sweeper has marked as expired
+func GetExpiredLinks(userID string) ([]Link, error) {
+	query := `
+		SELECT ` + linkColumns + `
+		FROM links
+		WHERE created_by = $1 AND expired_at IS NOT NULL AND deleted_at IS NULL
+		ORDER BY expired_at DESC
+	`
 
-	return links, nil
+	return queryLinks(query, userID)
+}
+
+// MarkExpiredLinks sets expired_at on every link that ran past its expiry date or click budget
+// and returns how many links were marked
+func MarkExpiredLinks() (int64, error) {
+	query := `
+		UPDATE links
+		SET expired_at = NOW()
+		WHERE expired_at IS NULL AND deleted_at IS NULL
+		AND ((expires_at IS NOT NULL AND expires_at <= NOW()) OR (max_clicks IS NOT NULL AND clicks >= max_clicks))
+	`
+
+	tag, err := Db.Exec(context.Background(), query)
+	if err != nil {
+		return 0, err
+	}
 
+	return tag.RowsAffected(), nil
 }
 
 // UpdateLinkClickCount increments the click count for a specific link
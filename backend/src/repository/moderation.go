@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ModeratedLink is a link whose status a moderation changed, its cached copy has to be dropped
+type ModeratedLink struct {
+	ID       int
+	ShortId  string
+	DomainID *int
+}
+
+// DisableLink blocks a link that is not deleted or disabled yet, changedBy is nil for the system.
+// The reason is kept in the link history and the audit log. It returns the disabled link, nil when nothing changed
+func DisableLink(linkID int, reason string, changedBy *string) (*ModeratedLink, error) {
+	links, err := moderate(func(tx pgx.Tx) ([]ModeratedLink, error) {
+		return disableLinks(tx, "id = $1", linkID, reason, changedBy)
+	})
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+	return &links[0], nil
+}
+
+// SetLinkDisabled disables or enables a link on behalf of an admin. Enabling only applies to disabled links,
+// the link is active afterwards. It returns the changed link, nil when nothing changed
+func SetLinkDisabled(linkID int, disabled bool, reason string, adminID string) (*ModeratedLink, error) {
+	links, err := moderate(func(tx pgx.Tx) ([]ModeratedLink, error) {
+		if disabled {
+			return disableLinks(tx, "id = $1", linkID, reason, &adminID)
+		}
+		return enableLink(tx, linkID, reason, adminID)
+	})
+	if err != nil || len(links) == 0 {
+		return nil, err
+	}
+	return &links[0], nil
+}
+
+// SetUserSuspended suspends or reinstates a user on behalf of an admin. Suspending also disables every link
+// of the user, reinstating leaves them disabled so each can be reviewed. It returns the links that were
+// disabled and reports whether the user changed
+func SetUserSuspended(userID string, suspended bool, reason string, adminID string) (bool, []ModeratedLink, error) {
+	changed := false
+	links, err := moderate(func(tx pgx.Tx) ([]ModeratedLink, error) {
+		var err error
+		var links []ModeratedLink
+		if suspended {
+			changed, links, err = suspendUser(tx, userID, reason, adminID)
+		} else {
+			changed, err = reinstateUser(tx, userID, reason, adminID)
+		}
+		return links, err
+	})
+	return changed, links, err
+}
+
+// moderate runs the changes in a transaction
+func moderate(change func(tx pgx.Tx) ([]ModeratedLink, error)) ([]ModeratedLink, error) {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	links, err := change(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return links, tx.Commit(ctx)
+}
+
+// setLinksStatus sets the status of the links the condition selects, condition compares against $1.
+// Every changed link gets a history entry with its previous status and an audit entry
+func setLinksStatus(tx pgx.Tx, condition string, arg any, status LinkStatus, event HistoryEvent, action AuditAction, reason string, changedBy *string) ([]ModeratedLink, error) {
+	// The subquery locks the rows and keeps their status from before the update
+	query := `
+		UPDATE links
+		SET status = $2, paused_url = NULL
+		FROM (
+			SELECT id AS previous_id, status AS previous_status
+			FROM links
+			WHERE ` + condition + ` AND status <> $2 AND deleted_at IS NULL
+			FOR UPDATE
+		) previous
+		WHERE links.id = previous.previous_id
+		RETURNING links.id, links.short_id, links.domain_id, previous.previous_status
+	`
+
+	ctx := context.Background()
+	rows, err := tx.Query(ctx, query, arg, status)
+	if err != nil {
+		return nil, err
+	}
+	var links []ModeratedLink
+	var previous []string
+	for rows.Next() {
+		var link ModeratedLink
+		var status string
+		if err := rows.Scan(&link.ID, &link.ShortId, &link.DomainID, &status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		links = append(links, link)
+		previous = append(previous, status)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i, link := range links {
+		err := createLinkHistory(tx, LinkHistory{
+			LinkID:    link.ID,
+			Event:     event,
+			OldValue:  &previous[i],
+			NewValue:  &reason,
+			CreatedBy: changedBy,
+			CreatedAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		err = createAuditEntry(tx, AuditEntry{
+			ActorID:    changedBy,
+			Action:     action,
+			TargetType: AuditTargetLink,
+			TargetID:   strconv.Itoa(link.ID),
+			Details:    &reason,
+			CreatedAt:  now,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return links, nil
+}
+
+func disableLinks(tx pgx.Tx, condition string, arg any, reason string, changedBy *string) ([]ModeratedLink, error) {
+	return setLinksStatus(tx, condition, arg, LinkDisabled, HistoryDisabled, AuditLinkDisabled, reason, changedBy)
+}
+
+func enableLink(tx pgx.Tx, linkID int, reason string, adminID string) ([]ModeratedLink, error) {
+	return setLinksStatus(tx, "id = $1 AND status = 'disabled'", linkID, LinkActive, HistoryEnabled, AuditLinkEnabled, reason, &adminID)
+}
+
+func suspendUser(tx pgx.Tx, userID string, reason string, adminID string) (bool, []ModeratedLink, error) {
+	query := `
+		UPDATE users SET suspended_at = $2 WHERE id = $1 AND suspended_at IS NULL
+	`
+
+	now := time.Now()
+	tag, err := tx.Exec(context.Background(), query, userID, now)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, nil, err
+	}
+	err = createAuditEntry(tx, AuditEntry{
+		ActorID:    &adminID,
+		Action:     AuditUserSuspended,
+		TargetType: AuditTargetUser,
+		TargetID:   userID,
+		Details:    &reason,
+		CreatedAt:  now,
+	})
+	if err != nil {
+		return false, nil, err
+	}
+
+	links, err := disableLinks(tx, "created_by = $1", userID, "owner suspended: "+reason, &adminID)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, links, nil
+}
+
+func reinstateUser(tx pgx.Tx, userID string, reason string, adminID string) (bool, error) {
+	query := `
+		UPDATE users SET suspended_at = NULL WHERE id = $1 AND suspended_at IS NOT NULL
+	`
+
+	tag, err := tx.Exec(context.Background(), query, userID)
+	if err != nil || tag.RowsAffected() == 0 {
+		return false, err
+	}
+	err = createAuditEntry(tx, AuditEntry{
+		ActorID:    &adminID,
+		Action:     AuditUserUnsuspended,
+		TargetType: AuditTargetUser,
+		TargetID:   userID,
+		Details:    &reason,
+		CreatedAt:  time.Now(),
+	})
+	return err == nil, err
+}
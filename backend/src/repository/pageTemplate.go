@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PageTemplate is a page a user uploaded to replace the built in not found, paused or expired page
+type PageTemplate struct {
+	ID        int       `json:"id"`
+	UserID    string    `json:"userId"`
+	Page      string    `json:"page"`
+	Body      string    `json:"body"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+const pageTemplateColumns = `id, user_id, page, body, updated_at`
+
+func scanPageTemplate(row pgx.Row) (PageTemplate, error) {
+	var pageTemplate PageTemplate
+	err := row.Scan(&pageTemplate.ID, &pageTemplate.UserID, &pageTemplate.Page, &pageTemplate.Body, &pageTemplate.UpdatedAt)
+	return pageTemplate, err
+}
+
+// SavePageTemplate creates the template or replaces the user's existing template for the page
+func SavePageTemplate(pageTemplate PageTemplate) (PageTemplate, error) {
+	query := `
+		INSERT INTO page_templates (user_id, page, body, updated_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, page) DO UPDATE SET body = EXCLUDED.body, updated_at = EXCLUDED.updated_at
+		RETURNING ` + pageTemplateColumns
+
+	return scanPageTemplate(Db.QueryRow(context.Background(), query, pageTemplate.UserID, pageTemplate.Page, pageTemplate.Body, pageTemplate.UpdatedAt))
+}
+
+// GetPageTemplate gets the user's template for the page, nil when the user did not upload one
+func GetPageTemplate(userID string, page string) (*PageTemplate, error) {
+	query := `
+		SELECT ` + pageTemplateColumns + `
+		FROM page_templates
+		WHERE user_id = $1 AND page = $2
+	`
+
+	pageTemplate, err := scanPageTemplate(Db.QueryRow(context.Background(), query, userID, page))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &pageTemplate, nil
+}
+
+func GetPageTemplates(userID string) ([]PageTemplate, error) {
+	query := `
+		SELECT ` + pageTemplateColumns + `
+		FROM page_templates
+		WHERE user_id = $1
+		ORDER BY page
+	`
+
+	pageTemplates := make([]PageTemplate, 0)
+	rows, err := Db.Query(context.Background(), query, userID)
+	if err != nil {
+		return pageTemplates, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		pageTemplate, err := scanPageTemplate(rows)
+		if err != nil {
+			return pageTemplates, err
+		}
+		pageTemplates = append(pageTemplates, pageTemplate)
+	}
+
+	return pageTemplates, rows.Err()
+}
+
+func DeletePageTemplate(userID string, page string) error {
+	query := `
+		DELETE FROM page_templates WHERE user_id = $1 AND page = $2
+	`
+
+	_, err := Db.Exec(context.Background(), query, userID, page)
+	return err
+}
@@ -1,12 +1,28 @@
 package repository
 
-import "context"
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
 
 type TargetType string
 
 const (
 	Header TargetType = "header"
 	Cookie TargetType = "cookie"
+	// Query rules match a parameter of the query string of the short link
+	Query TargetType = "query"
+	// Country rules match the ISO 3166-1 alpha-2 code of the visitor's country, e.g. "DE"
+	Country TargetType = "country"
+	// Device, OS and Browser rules match the visitor's User-Agent, see rules.Agent for the values
+	Device  TargetType = "device"
+	OS      TargetType = "os"
+	Browser TargetType = "browser"
+	// Schedule rules match while the visit falls into the rule's Schedule
+	Schedule TargetType = "schedule"
 )
 
 type TargetMethod string
@@ -27,19 +43,68 @@ type Redirect struct {
 	RedirectURL  string       `json:"redirectURL"`
 	TargetValue  *string      `json:"targetValue"`
 	TargetName   *string      `json:"targetName"`
+	// Priority orders the rules of a link, lower values are evaluated first
+	Priority int `json:"priority"`
+	// Schedule is the time window of schedule rules, nil for the other target types
+	Schedule *RedirectSchedule `json:"schedule"`
+	// Condition decides whether the rule fires. The target fields above mirror it for rules with a single
+	// condition and are empty for compound rules
+	Condition *Condition `json:"condition"`
+}
+
+// Condition is a node of a rule expression. A group sets exactly one of And, Or and Not, a leaf sets Type
+// and tests a single target like a rule with one condition
+type Condition struct {
+	And []Condition `json:"and,omitempty"`
+	Or  []Condition `json:"or,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	Type     TargetType        `json:"type,omitempty"`
+	Method   TargetMethod      `json:"method,omitempty"`
+	Name     *string           `json:"name,omitempty"`
+	Value    *string           `json:"value,omitempty"`
+	Schedule *RedirectSchedule `json:"schedule,omitempty"`
+	// IgnoreCase compares the value without regard to case, Negate inverts the result of the leaf
+	IgnoreCase bool `json:"ignoreCase,omitempty"`
+	Negate     bool `json:"negate,omitempty"`
+}
+
+// RedirectSchedule is an absolute time window and a recurring weekly window, a rule matches when the visit is
+// inside both. Unset fields do not restrict the window
+type RedirectSchedule struct {
+	Start *time.Time `json:"start"`
+	End   *time.Time `json:"end"`
+	// Days are the weekdays of the weekly window as "mon" to "sun", every day when empty
+	Days []string `json:"days"`
+	// From and To are the time of day of the weekly window as "15:04", To may be "24:00".
+	// A window with To before From runs past midnight into the next day
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Timezone is the IANA name of the timezone Days, From and To are in, UTC when empty
+	Timezone string `json:"timezone"`
 }
 
+var ErrRedirectOrderMismatch = errors.New("order must list every redirect of the link exactly once")
+
+// redirectColumns is the column list matching scanRedirect
+const redirectColumns = `id, link_id, COALESCE(target_type, ''), COALESCE(target_method, ''), redirect_url, target_value, target_name, priority, schedule, condition`
+
+func scanRedirect(row pgx.Row) (Redirect, error) {
+	var redirect Redirect
+	err := row.Scan(&redirect.ID, &redirect.LinkID, &redirect.TargetType, &redirect.TargetMethod, &redirect.RedirectURL, &redirect.TargetValue, &redirect.TargetName, &redirect.Priority, &redirect.Schedule, &redirect.Condition)
+	return redirect, err
+}
+
+// CreateRedirect adds a rule after the existing rules of the link
 func CreateRedirect(redirect Redirect) (Redirect, error) {
 	query := `
-		INSERT INTO redirects (link_id, target_type, target_method, redirect_url, target_value, target_name)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING *
-	`
+		INSERT INTO redirects (link_id, target_type, target_method, redirect_url, target_value, target_name, schedule, condition, priority)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6, $7, $8, (SELECT COALESCE(MAX(priority) + 1, 0) FROM redirects WHERE link_id = $1))
+		RETURNING ` + redirectColumns
 
-	row := Db.QueryRow(context.Background(), query, redirect.LinkID, redirect.TargetType, redirect.TargetMethod, redirect.RedirectURL, redirect.TargetValue, redirect.TargetName)
+	row := Db.QueryRow(context.Background(), query, redirect.LinkID, redirect.TargetType, redirect.TargetMethod, redirect.RedirectURL, redirect.TargetValue, redirect.TargetName, redirect.Schedule, redirect.Condition)
 
-	var createdRedirect Redirect
-	err := row.Scan(&createdRedirect.ID, &createdRedirect.LinkID, &createdRedirect.TargetType, &createdRedirect.TargetMethod, &createdRedirect.RedirectURL, &createdRedirect.TargetValue, &createdRedirect.TargetName)
+	createdRedirect, err := scanRedirect(row)
 	if err != nil {
 		return Redirect{}, err
 	}
@@ -47,9 +112,10 @@ func CreateRedirect(redirect Redirect) (Redirect, error) {
 	return createdRedirect, nil
 }
 
+// GetRedirectsByLinkID gets the rules of a link in evaluation order
 func GetRedirectsByLinkID(linkID string) ([]Redirect, error) {
 	query := `
-		SELECT * FROM redirects WHERE link_id = $1
+		SELECT ` + redirectColumns + ` FROM redirects WHERE link_id = $1 ORDER BY priority, id
 	`
 
 	rows, err := Db.Query(context.Background(), query, linkID)
@@ -57,17 +123,89 @@ func GetRedirectsByLinkID(linkID string) ([]Redirect, error) {
 	if err != nil {
 		return redirects, err
 	}
+	defer rows.Close()
 
 	for rows.Next() {
-		var redirect Redirect
-		err := rows.Scan(&redirect.ID, &redirect.LinkID, &redirect.TargetType, &redirect.TargetMethod, &redirect.RedirectURL, &redirect.TargetValue, &redirect.TargetName)
+		redirect, err := scanRedirect(rows)
 		if err != nil {
 			return redirects, err
 		}
 		redirects = append(redirects, redirect)
 	}
 
-	return redirects, nil
+	return redirects, rows.Err()
+}
+
+// ReorderRedirects sets the evaluation order of the rules of a link, ids has to list all of them
+func ReorderRedirects(linkID int, ids []int) error {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the rules so a rule created meanwhile can not be left out of the order
+	rows, err := tx.Query(ctx, `SELECT id FROM redirects WHERE link_id = $1 FOR UPDATE`, linkID)
+	if err != nil {
+		return err
+	}
+	existing := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(ids) != len(existing) {
+		return ErrRedirectOrderMismatch
+	}
+	positions := make([]int32, len(ids))
+	redirectIDs := make([]int32, len(ids))
+	for i, id := range ids {
+		if !existing[id] {
+			return ErrRedirectOrderMismatch
+		}
+		delete(existing, id)
+		redirectIDs[i] = int32(id)
+		positions[i] = int32(i)
+	}
+
+	query := `
+		UPDATE redirects
+		SET priority = ordered.position
+		FROM (SELECT unnest($2::int[]) AS id, unnest($3::int[]) AS position) ordered
+		WHERE redirects.id = ordered.id AND redirects.link_id = $1
+	`
+	if _, err := tx.Exec(ctx, query, linkID, redirectIDs, positions); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetRedirect gets a redirect by id, nil when it does not exist
+func GetRedirect(redirectID string) (*Redirect, error) {
+	query := `
+		SELECT ` + redirectColumns + ` FROM redirects WHERE id = $1
+	`
+
+	redirect, err := scanRedirect(Db.QueryRow(context.Background(), query, redirectID))
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &redirect, nil
 }
 
 func DeleteRedirect(redirectID string) error {
@@ -83,16 +221,16 @@ func DeleteRedirect(redirectID string) error {
 	return nil
 }
 
+// UpdateRedirect updates the rule with the id, the link it belongs to can not change
 func UpdateRedirect(redirect Redirect) (Redirect, error) {
 	query := `
-		UPDATE redirects SET target_type = $1, target_method = $2, redirect_url = $3, target_value = $4, target_name = $5 WHERE id = $6
-		RETURNING *
+		UPDATE redirects SET target_type = NULLIF($1, ''), target_method = NULLIF($2, ''), redirect_url = $3, target_value = $4, target_name = $5, schedule = $7, condition = $8 WHERE id = $6
+		RETURNING ` + redirectColumns + `
 	`
 
-	row := Db.QueryRow(context.Background(), query, redirect.TargetType, redirect.TargetMethod, redirect.RedirectURL, redirect.TargetValue, redirect.TargetName, redirect.ID)
+	row := Db.QueryRow(context.Background(), query, redirect.TargetType, redirect.TargetMethod, redirect.RedirectURL, redirect.TargetValue, redirect.TargetName, redirect.ID, redirect.Schedule, redirect.Condition)
 
-	var updatedRedirect Redirect
-	err := row.Scan(&updatedRedirect.ID, &updatedRedirect.LinkID, &updatedRedirect.TargetType, &updatedRedirect.TargetMethod, &updatedRedirect.RedirectURL)
+	updatedRedirect, err := scanRedirect(row)
 	if err != nil {
 		return Redirect{}, err
 	}
@@ -39,7 +39,7 @@ type Package struct {
 	Price         int      `json:"price"`
 	MaxLinks      int      `json:"maxLinks"`
 	MaxClicks     int      `json:"maxClicks"`
-	CustomDomains int      `json:"customDomains"` // Will add this later if ever
+	CustomDomains int      `json:"customDomains"`
 	IsDefault     bool     `json:"isDefault"`
 	Features      []string `json:"features"`
 	PriceID       string   `json:"priceId"` // stripe price id
@@ -48,26 +48,74 @@ type Package struct {
 type Billing struct {
 	Package      *Package      `json:"package"`
 	Subscription *Subscription `json:"subscription"`
+	Usage        *Usage        `json:"usage"`
+}
+
+// Usage is what a user has used of their package, limits are nil when no package applies
+type Usage struct {
+	Links         int       `json:"links"`
+	MaxLinks      *int      `json:"maxLinks"`
+	MonthlyClicks int       `json:"monthlyClicks"`
+	MaxClicks     *int      `json:"maxClicks"`
+	PeriodStart   time.Time `json:"periodStart"`
+}
+
+// packageColumns is the column list matching scanPackage, features and price_id are optional in the table
+const packageColumns = `id, name, COALESCE(description, ''), price, max_links, max_clicks, custom_domains, is_default, COALESCE(features, '[]'::jsonb)::text, COALESCE(price_id, '')`
+
+func scanPackage(row pgx.Row) (Package, error) {
+	var subPackage Package
+	var featuresJson string
+	err := row.Scan(&subPackage.ID, &subPackage.Name, &subPackage.Description, &subPackage.Price, &subPackage.MaxLinks, &subPackage.MaxClicks, &subPackage.CustomDomains, &subPackage.IsDefault, &featuresJson, &subPackage.PriceID)
+	if err != nil {
+		return subPackage, err
+	}
+	err = json.Unmarshal([]byte(featuresJson), &subPackage.Features)
+	return subPackage, err
 }
 
 // GetPackageByID gets a package by id
 func GetPackageByID(id string) (*Package, error) {
 	query := `
-		SELECT * FROM packages WHERE id = $1
+		SELECT ` + packageColumns + ` FROM packages WHERE id = $1
 	`
 
-	row := Db.QueryRow(context.Background(), query, id)
+	subPackage, err := scanPackage(Db.QueryRow(context.Background(), query, id))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &subPackage, nil
+}
+
+// GetPackageByPriceID gets the package sold with the given stripe price
+func GetPackageByPriceID(priceID string) (*Package, error) {
+	query := `
+		SELECT ` + packageColumns + ` FROM packages WHERE price_id = $1
+	`
 
-	var subPackage Package
-	var featuresJson string
-	err := row.Scan(&subPackage.ID, &subPackage.Name, &subPackage.Description, &subPackage.Price, &subPackage.MaxLinks, &subPackage.MaxClicks, &subPackage.CustomDomains, &subPackage.IsDefault, &featuresJson, &subPackage.PriceID)
+	subPackage, err := scanPackage(Db.QueryRow(context.Background(), query, priceID))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
-	err = json.Unmarshal([]byte(featuresJson), &subPackage.Features)
+	return &subPackage, nil
+}
+
+// GetDefaultPackage gets the package used by users without a subscription
+func GetDefaultPackage() (*Package, error) {
+	query := `
+		SELECT ` + packageColumns + ` FROM packages WHERE is_default = TRUE
+	`
+
+	subPackage, err := scanPackage(Db.QueryRow(context.Background(), query))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -76,7 +124,7 @@ func GetPackageByID(id string) (*Package, error) {
 
 func GetPackages() ([]Package, error) {
 	query := `
-		SELECT * FROM packages
+		SELECT ` + packageColumns + ` FROM packages
 	`
 
 	rows, err := Db.Query(context.Background(), query)
@@ -87,13 +135,7 @@ func GetPackages() ([]Package, error) {
 
 	var packages []Package
 	for rows.Next() {
-		var subPackage Package
-		var featuresJson string
-		err := rows.Scan(&subPackage.ID, &subPackage.Name, &subPackage.Description, &subPackage.Price, &subPackage.MaxLinks, &subPackage.MaxClicks, &subPackage.CustomDomains, &subPackage.IsDefault, &featuresJson, &subPackage.PriceID)
-		if err != nil {
-			return nil, err
-		}
-		err = json.Unmarshal([]byte(featuresJson), &subPackage.Features)
+		subPackage, err := scanPackage(rows)
 		if err != nil {
 			return nil, err
 		}
@@ -105,39 +147,46 @@ func GetPackages() ([]Package, error) {
 
 func CreateSubscription(subscription Subscription) (Subscription, error) {
 	query := `
-		INSERT INTO subscriptions (id, customer_id, status, current_period_end, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO subscriptions (id, customer_id, status, current_period_end, created_at, updated_at, package_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
 	`
 
 	_, err := Db.Exec(context.Background(), query, subscription.ID, subscription.CustomerID, subscription.Status,
-		subscription.CurrentPeriodEnd, subscription.CreatedAt, subscription.UpdatedAt)
+		subscription.CurrentPeriodEnd, subscription.CreatedAt, subscription.UpdatedAt, subscription.PackageID)
 
 	return subscription, err
 }
 
-// UpdateSubscription updates a subscription in the database, only the status, current_period_end and updated_at can be updated
+// UpdateSubscription updates the status, current_period_end, updated_at and package of a subscription.
+// An empty package id keeps the current package
 func UpdateSubscription(subscription Subscription) (Subscription, error) {
 	query := `
 		UPDATE subscriptions
-		SET status = $2, current_period_end = $3, updated_at = $4
+		SET status = $2, current_period_end = $3, updated_at = $4, package_id = COALESCE(NULLIF($5, ''), package_id)
 		WHERE id = $1
 	`
 
-	_, err := Db.Exec(context.Background(), query, subscription.ID, subscription.Status, subscription.CurrentPeriodEnd, subscription.UpdatedAt)
+	_, err := Db.Exec(context.Background(), query, subscription.ID, subscription.Status, subscription.CurrentPeriodEnd, subscription.UpdatedAt, subscription.PackageID)
+
+	return subscription, err
+}
+
+// subscriptionColumns is the column list matching scanSubscription
+const subscriptionColumns = `id, customer_id, status, current_period_end, created_at, updated_at, COALESCE(package_id, '')`
 
+func scanSubscription(row pgx.Row) (Subscription, error) {
+	var subscription Subscription
+	err := row.Scan(&subscription.ID, &subscription.CustomerID, &subscription.Status, &subscription.CurrentPeriodEnd, &subscription.CreatedAt, &subscription.UpdatedAt, &subscription.PackageID)
 	return subscription, err
 }
 
 // GetSubscriptionByCustomerId gets a subscription by customer id. This is assigned by stripe
 func GetSubscriptionByCustomerId(customerId string) (*Subscription, error) {
 	query := `
-		SELECT * FROM subscriptions WHERE customer_id = $1
+		SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE customer_id = $1
 	`
 
-	row := Db.QueryRow(context.Background(), query, customerId)
-
-	var subscription Subscription
-	err := row.Scan(&subscription.ID, &subscription.CustomerID, &subscription.Status, &subscription.CurrentPeriodEnd, &subscription.CreatedAt, &subscription.UpdatedAt)
+	subscription, err := scanSubscription(Db.QueryRow(context.Background(), query, customerId))
 	if err == pgx.ErrNoRows {
 		return nil, nil // Return nil, nil when no subscription is found
 	}
@@ -149,31 +198,8 @@ func GetSubscriptionByCustomerId(customerId string) (*Subscription, error) {
 
 func GetSubscriptionByID(id string) (Subscription, error) {
 	query := `
-		SELECT * FROM subscriptions WHERE id = $1
+		SELECT ` + subscriptionColumns + ` FROM subscriptions WHERE id = $1
 	`
 
-	row := Db.QueryRow(context.Background(), query, id)
-
-	var subscription Subscription
-	err := row.Scan(&subscription.ID, &subscription.CustomerID, &subscription.Status, &subscription.CurrentPeriodEnd, &subscription.CreatedAt, &subscription.UpdatedAt)
-
-	return subscription, err
-}
-
-func GetPackageById(id string) (*Package, error) {
-	query := `
-		SELECT * FROM packages WHERE id = $1
-	`
-
-	row := Db.QueryRow(context.Background(), query, id)
-
-	var subPackage Package
-	err := row.Scan(&subPackage.ID, &subPackage.Name, &subPackage.Description, &subPackage.Price, &subPackage.MaxLinks, &subPackage.MaxClicks, &subPackage.CustomDomains, &subPackage.IsDefault)
-	if err == pgx.ErrNoRows {
-		return nil, nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	return &subPackage, nil
+	return scanSubscription(Db.QueryRow(context.Background(), query, id))
 }
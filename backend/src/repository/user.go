@@ -17,6 +17,29 @@ type User struct {
 	IpAddress        string    `json:"ipAddress"`
 	UserAgent        string    `json:"userAgent"`
 	StripeCustomerID *string   `json:"stripeCustomerID"`
+	Role             UserRole  `json:"role"`
+	// SuspendedAt is set while an admin has suspended the account, suspended users can not sign in
+	SuspendedAt *time.Time `json:"suspendedAt"`
+}
+
+type UserRole string
+
+const (
+	RoleUser  UserRole = "user"
+	RoleAdmin UserRole = "admin"
+)
+
+// IsAdmin reports whether the user may moderate links and users
+func (user *User) IsAdmin() bool {
+	return user.Role == RoleAdmin
+}
+
+const userColumns = `id, email, password, created_at, updated_at, ip_address, user_agent, stripe_customer_id, role, suspended_at`
+
+func scanUser(row pgx.Row) (User, error) {
+	var user User
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.IpAddress, &user.UserAgent, &user.StripeCustomerID, &user.Role, &user.SuspendedAt)
+	return user, err
 }
 
 func CreateUser(user User) (string, error) {
@@ -34,12 +57,9 @@ func CreateUser(user User) (string, error) {
 
 func GetUserByEmail(email string) (*User, error) {
 	query := `
-		SELECT * FROM users WHERE email = $1
+		SELECT ` + userColumns + ` FROM users WHERE email = $1
 	`
-	fmt.Println(email)
-	row := Db.QueryRow(context.Background(), query, email)
-	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.IpAddress, &user.UserAgent, &user.StripeCustomerID)
+	user, err := scanUser(Db.QueryRow(context.Background(), query, email))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
@@ -52,11 +72,9 @@ func GetUserByEmail(email string) (*User, error) {
 
 func GetUserByID(id string) (*User, error) {
 	query := `
-		SELECT * FROM users WHERE id = $1
+		SELECT ` + userColumns + ` FROM users WHERE id = $1
 	`
-	row := Db.QueryRow(context.Background(), query, id)
-	var user User
-	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.CreatedAt, &user.UpdatedAt, &user.IpAddress, &user.UserAgent, &user.StripeCustomerID)
+	user, err := scanUser(Db.QueryRow(context.Background(), query, id))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Variant is one destination of a link that rotates its traffic. Visitors get a variant with a chance of
+// Weight out of the total weight of the link's variants
+type Variant struct {
+	ID        int       `json:"id"`
+	LinkID    int       `json:"linkId"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Weight    int       `json:"weight"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+var ErrVariantNotFound = errors.New("variant does not belong to the link")
+
+const variantColumns = `id, link_id, name, url, weight, created_at`
+
+func scanVariant(row pgx.Row) (Variant, error) {
+	var variant Variant
+	err := row.Scan(&variant.ID, &variant.LinkID, &variant.Name, &variant.URL, &variant.Weight, &variant.CreatedAt)
+	return variant, err
+}
+
+// GetVariants gets the variants of a link in the order they were created
+func GetVariants(linkID int) ([]Variant, error) {
+	query := `
+		SELECT ` + variantColumns + `
+		FROM link_variants
+		WHERE link_id = $1
+		ORDER BY id
+	`
+
+	variants := make([]Variant, 0)
+	rows, err := Db.Query(context.Background(), query, linkID)
+	if err != nil {
+		return variants, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return variants, err
+		}
+		variants = append(variants, variant)
+	}
+
+	return variants, rows.Err()
+}
+
+// SaveVariants replaces the variants of a link. Variants with an id are updated so their clicks stay attributed,
+// variants without one are created and variants that are left out are deleted
+func SaveVariants(linkID int, variants []Variant) ([]Variant, error) {
+	ctx := context.Background()
+	tx, err := Db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	saved := make([]Variant, 0, len(variants))
+	kept := make([]int32, 0, len(variants))
+	for _, variant := range variants {
+		var row pgx.Row
+		if variant.ID != 0 {
+			row = tx.QueryRow(ctx, `
+				UPDATE link_variants SET name = $3, url = $4, weight = $5
+				WHERE id = $1 AND link_id = $2
+				RETURNING `+variantColumns, variant.ID, linkID, variant.Name, variant.URL, variant.Weight)
+		} else {
+			row = tx.QueryRow(ctx, `
+				INSERT INTO link_variants (link_id, name, url, weight, created_at)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING `+variantColumns, linkID, variant.Name, variant.URL, variant.Weight, time.Now())
+		}
+		savedVariant, err := scanVariant(row)
+		if err == pgx.ErrNoRows {
+			return nil, ErrVariantNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, savedVariant)
+		kept = append(kept, int32(savedVariant.ID))
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM link_variants WHERE link_id = $1 AND NOT (id = ANY($2::int[]))`, linkID, kept)
+	if err != nil {
+		return nil, err
+	}
+
+	return saved, tx.Commit(ctx)
+}
+
+type VariantStatistics struct {
+	VariantID int    `json:"variantId"`
+	Name      string `json:"name"`
+	URL       string `json:"url"`
+	Weight    int    `json:"weight"`
+	Clicks    int    `json:"clicks"`
+}
+
+// GetVariantStatistics counts the clicks of every current variant of the link in the date range
+func GetVariantStatistics(linkID string, startDate time.Time, endDate time.Time) ([]VariantStatistics, error) {
+	query := `
+		SELECT link_variants.id, link_variants.name, link_variants.url, link_variants.weight, COUNT(clicks.id)
+		FROM link_variants
+		LEFT JOIN clicks ON clicks.variant_id = link_variants.id
+			AND clicks.created_at BETWEEN $2 AND $3 AND NOT clicks.paused
+		WHERE link_variants.link_id = $1
+		GROUP BY link_variants.id
+		ORDER BY link_variants.id
+	`
+
+	statistics := make([]VariantStatistics, 0)
+	rows, err := Db.Query(context.Background(), query, linkID, startDate, endDate)
+	if err != nil {
+		return statistics, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stat VariantStatistics
+		err := rows.Scan(&stat.VariantID, &stat.Name, &stat.URL, &stat.Weight, &stat.Clicks)
+		if err != nil {
+			return statistics, err
+		}
+		statistics = append(statistics, stat)
+	}
+
+	return statistics, rows.Err()
+}
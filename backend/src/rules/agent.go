@@ -0,0 +1,70 @@
+package rules
+
+import (
+	"strings"
+
+	"github.com/mssola/useragent"
+)
+
+// Device values of device rules
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// Agent is the device, operating system and browser of a visitor read from the User-Agent header.
+// Values are lower case, OS is one of ios, android, windows, macos, chromeos, linux or the name reported by the
+// agent, Browser is the browser name like chrome, firefox, safari or edge
+type Agent struct {
+	Device  string `json:"device"`
+	OS      string `json:"os"`
+	Browser string `json:"browser"`
+}
+
+// ParseAgent reads the agent from a User-Agent header value
+func ParseAgent(userAgent string) Agent {
+	ua := useragent.New(userAgent)
+	browser, _ := ua.Browser()
+	return Agent{
+		Device:  device(ua),
+		OS:      operatingSystem(ua),
+		Browser: strings.ToLower(browser),
+	}
+}
+
+func device(ua *useragent.UserAgent) string {
+	switch {
+	case ua.Bot():
+		return DeviceBot
+	case ua.Platform() == "iPad":
+		return DeviceTablet
+	// Android tablets leave the Mobile token out of their User-Agent
+	case strings.Contains(ua.OS(), "Android") && !strings.Contains(ua.UA(), "Mobile"):
+		return DeviceTablet
+	case ua.Mobile():
+		return DeviceMobile
+	}
+	return DeviceDesktop
+}
+
+func operatingSystem(ua *useragent.UserAgent) string {
+	name := ua.OSInfo().Name
+	platform := ua.Platform()
+	switch {
+	case platform == "iPhone" || platform == "iPad" || platform == "iPod" || strings.HasPrefix(name, "iPhone OS"):
+		return "ios"
+	case strings.Contains(name, "Android"):
+		return "android"
+	case strings.HasPrefix(name, "Windows"):
+		return "windows"
+	case strings.HasPrefix(name, "Mac OS"):
+		return "macos"
+	case strings.Contains(name, "CrOS"):
+		return "chromeos"
+	case strings.Contains(name, "Linux") || platform == "Linux":
+		return "linux"
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,230 @@
+package rules
+
+import (
+	"link-shortener-backend/src/repository"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// RuleSet is the compiled form of the rules of a link. Patterns are compiled and targets normalized once,
+// so matching a request does not allocate for most rules. A RuleSet is safe for concurrent use
+type RuleSet struct {
+	redirects   []repository.Redirect
+	conditions  []node
+	usesCountry bool
+}
+
+type nodeKind int
+
+const (
+	leafNode nodeKind = iota
+	andNode
+	orNode
+	notNode
+)
+
+// node is a compiled condition. Leaves keep the target in the form it is compared in: lowercased for
+// case insensitive methods and compiled for regexes
+type node struct {
+	kind     nodeKind
+	children []node
+
+	targetType repository.TargetType
+	method     repository.TargetMethod
+	name       string
+	value      string
+	regex      *regexp.Regexp
+	schedule   *repository.RedirectSchedule
+	ignoreCase bool
+	negate     bool
+	// invalid leaves never match, like rules stored before their pattern was validated
+	invalid bool
+}
+
+// Compile compiles the rules of a link, they have to be sorted by priority like GetRedirectsByLinkID returns them
+func Compile(redirects []repository.Redirect) *RuleSet {
+	set := &RuleSet{redirects: redirects, conditions: make([]node, len(redirects))}
+	for i, redirect := range redirects {
+		set.conditions[i] = compileNode(condition(redirect))
+		if set.conditions[i].uses(repository.Country) {
+			set.usesCountry = true
+		}
+	}
+	return set
+}
+
+// Match returns the first rule that matches the request, nil when none does
+func (s *RuleSet) Match(request *Request) *repository.Redirect {
+	for i := range s.conditions {
+		if s.conditions[i].matches(request) {
+			return &s.redirects[i]
+		}
+	}
+	return nil
+}
+
+// UsesCountry reports whether any of the rules match on the visitor's country
+func (s *RuleSet) UsesCountry() bool {
+	return s.usesCountry
+}
+
+func compileNode(condition *repository.Condition) node {
+	switch {
+	case condition.Not != nil:
+		return node{kind: notNode, children: []node{compileNode(condition.Not)}}
+	case condition.And != nil:
+		return node{kind: andNode, children: compileNodes(condition.And)}
+	case condition.Or != nil:
+		return node{kind: orNode, children: compileNodes(condition.Or)}
+	}
+	leaf := node{
+		kind:       leafNode,
+		targetType: condition.Type,
+		method:     condition.Method,
+		schedule:   condition.Schedule,
+		ignoreCase: condition.IgnoreCase,
+		negate:     condition.Negate,
+	}
+	if condition.Name != nil {
+		leaf.name = *condition.Name
+		if condition.Type == repository.Header {
+			leaf.name = textproto.CanonicalMIMEHeaderKey(leaf.name)
+		}
+	}
+	switch {
+	case condition.Type == repository.Schedule:
+		leaf.invalid = condition.Schedule == nil
+	case condition.Value == nil:
+		leaf.invalid = true
+	case condition.Name == nil && needsName(condition.Type):
+		leaf.invalid = true
+	case condition.Method == repository.Regex:
+		regex, err := compilePattern(*condition.Value, condition.IgnoreCase)
+		leaf.regex, leaf.invalid = regex, err != nil
+	case condition.IgnoreCase:
+		leaf.value = strings.ToLower(*condition.Value)
+	default:
+		// Rules stored before values were normalized get the form they are compared in
+		leaf.value = normalizeValue(condition.Type, *condition.Value)
+	}
+	return leaf
+}
+
+func compileNodes(conditions []repository.Condition) []node {
+	nodes := make([]node, len(conditions))
+	for i := range conditions {
+		nodes[i] = compileNode(&conditions[i])
+	}
+	return nodes
+}
+
+// compilePattern compiles the pattern of a regex condition
+func compilePattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+func needsName(targetType repository.TargetType) bool {
+	return targetType == repository.Header || targetType == repository.Cookie || targetType == repository.Query
+}
+
+// matches evaluates the condition. Groups stop at the first condition that decides them, so lookups
+// like parsing the user agent are only done when needed
+func (n *node) matches(request *Request) bool {
+	switch n.kind {
+	case notNode:
+		return !n.children[0].matches(request)
+	case andNode:
+		for i := range n.children {
+			if !n.children[i].matches(request) {
+				return false
+			}
+		}
+		return len(n.children) > 0
+	case orNode:
+		for i := range n.children {
+			if n.children[i].matches(request) {
+				return true
+			}
+		}
+		return false
+	}
+	if n.invalid {
+		return false
+	}
+	return n.matchLeaf(request) != n.negate
+}
+
+// matchLeaf reports whether the target of the leaf matches, before negation
+func (n *node) matchLeaf(request *Request) bool {
+	switch n.targetType {
+	case repository.Schedule:
+		return ScheduleActive(*n.schedule, request.Time)
+	case repository.Country:
+		return request.Country != "" && n.matchValue(request.Country)
+	case repository.Device:
+		return n.matchValue(request.Agent().Device)
+	case repository.OS:
+		agent := request.Agent()
+		return agent.OS != "" && n.matchValue(agent.OS)
+	case repository.Browser:
+		agent := request.Agent()
+		return agent.Browser != "" && n.matchValue(agent.Browser)
+	case repository.Header:
+		// The name is canonical already, so the header map is indexed directly
+		for _, value := range request.Headers[n.name] {
+			if n.matchValue(value) {
+				return true
+			}
+		}
+	case repository.Cookie:
+		value, ok := request.Cookies[n.name]
+		return ok && n.matchValue(value)
+	case repository.Query:
+		for _, value := range request.Query[n.name] {
+			if n.matchValue(value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (n *node) matchValue(value string) bool {
+	if n.method == repository.Regex {
+		return n.regex.MatchString(value)
+	}
+	if n.ignoreCase {
+		if n.method == repository.Match {
+			return strings.EqualFold(value, n.value)
+		}
+		value = strings.ToLower(value)
+	}
+	switch n.method {
+	case repository.Match:
+		return value == n.value
+	case repository.Contains:
+		return strings.Contains(value, n.value)
+	case repository.StartsWith:
+		return strings.HasPrefix(value, n.value)
+	case repository.EndsWith:
+		return strings.HasSuffix(value, n.value)
+	}
+	return false
+}
+
+// uses reports whether any leaf of the condition tests the target type
+func (n *node) uses(targetType repository.TargetType) bool {
+	if n.kind == leafNode {
+		return n.targetType == targetType
+	}
+	for i := range n.children {
+		if n.children[i].uses(targetType) {
+			return true
+		}
+	}
+	return false
+}
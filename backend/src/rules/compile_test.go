@@ -0,0 +1,297 @@
+package rules
+
+import (
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// evaluate is a direct reading of a condition tree the compiled matcher is checked against.
+// It compiles patterns and normalizes values on every call
+func evaluate(condition *repository.Condition, request *Request) bool {
+	switch {
+	case condition.Not != nil:
+		return !evaluate(condition.Not, request)
+	case condition.And != nil:
+		for i := range condition.And {
+			if !evaluate(&condition.And[i], request) {
+				return false
+			}
+		}
+		return len(condition.And) > 0
+	case condition.Or != nil:
+		for i := range condition.Or {
+			if evaluate(&condition.Or[i], request) {
+				return true
+			}
+		}
+		return false
+	}
+	if condition.Type == repository.Schedule {
+		return condition.Schedule != nil && ScheduleActive(*condition.Schedule, request.Time) != condition.Negate
+	}
+	if condition.Value == nil || (needsName(condition.Type) && condition.Name == nil) {
+		return false
+	}
+	var values []string
+	switch condition.Type {
+	case repository.Country:
+		values = []string{request.Country}
+	case repository.Device:
+		values = []string{request.Agent().Device}
+	case repository.OS:
+		values = []string{request.Agent().OS}
+	case repository.Browser:
+		values = []string{request.Agent().Browser}
+	case repository.Header:
+		values = request.Headers.Values(*condition.Name)
+	case repository.Cookie:
+		if value, ok := request.Cookies[*condition.Name]; ok {
+			values = []string{value}
+		}
+	case repository.Query:
+		values = request.Query[*condition.Name]
+	}
+	if condition.Type == repository.Country || condition.Type == repository.OS || condition.Type == repository.Browser {
+		// Unknown countries, systems and browsers match no value
+		if values[0] == "" {
+			values = nil
+		}
+	}
+	target := *condition.Value
+	var pattern *regexp.Regexp
+	if condition.Method == repository.Regex {
+		if condition.IgnoreCase {
+			target = "(?i)" + target
+		}
+		var err error
+		if pattern, err = regexp.Compile(target); err != nil {
+			return false
+		}
+	} else if condition.IgnoreCase {
+		target = strings.ToLower(target)
+	} else {
+		target = normalizeValue(condition.Type, target)
+	}
+	matched := false
+	for _, value := range values {
+		if condition.IgnoreCase {
+			value = strings.ToLower(value)
+		}
+		switch condition.Method {
+		case repository.Regex:
+			matched = pattern.MatchString(value)
+		case repository.Match:
+			matched = value == target
+		case repository.Contains:
+			matched = strings.Contains(value, target)
+		case repository.StartsWith:
+			matched = strings.HasPrefix(value, target)
+		case repository.EndsWith:
+			matched = strings.HasSuffix(value, target)
+		}
+		if matched {
+			break
+		}
+	}
+	return matched != condition.Negate
+}
+
+// sampleRequests are visits that each match some of the sample rules
+func sampleRequests() map[string]Request {
+	requests := map[string]Request{"none": sampleRequest()}
+	change := func(name string, edit func(request *Request)) {
+		request := sampleRequest()
+		request.Headers = request.Headers.Clone()
+		request.Cookies = map[string]string{"session": "abc", "plan": "free"}
+		request.Query = url.Values{"utm_source": {"newsletter"}, "ref": {"footer"}}
+		edit(&request)
+		requests[name] = request
+	}
+	change("german", func(request *Request) { request.Headers.Set("Accept-Language", "de-DE,de;q=0.9") })
+	change("partner", func(request *Request) { request.Headers.Set("Referer", "https://partner.example.com/") })
+	change("paid plan", func(request *Request) { request.Cookies["plan"] = "pro" })
+	change("no plan", func(request *Request) { delete(request.Cookies, "plan") })
+	change("ads", func(request *Request) { request.Query.Set("utm_source", "ads-summer") })
+	change("germany", func(request *Request) { request.Country = "DE" })
+	change("iphone", func(request *Request) {
+		request.Headers.Set("User-Agent", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1")
+	})
+	change("header ref", func(request *Request) { request.Query.Set("ref", "page-header") })
+	change("unknown country", func(request *Request) { request.Country = "" })
+	return requests
+}
+
+func TestCompiledMatchesConditions(t *testing.T) {
+	matchedRules := map[int]bool{}
+	for name, request := range sampleRequests() {
+		redirects := sampleRedirects(7)
+		set := Compile(redirects)
+		for i := range redirects {
+			visit := request
+			want := evaluate(redirects[i].Condition, &visit)
+			visit = request
+			got := Compile(redirects[i:i+1]).Match(&visit) != nil
+			if got != want {
+				t.Errorf("%s: rule %d matched = %v, want %v", name, redirects[i].ID, got, want)
+			}
+			if want {
+				matchedRules[redirects[i].ID] = true
+			}
+		}
+		visit := request
+		compiled := set.Match(&visit)
+		uncompiled := Match(redirects, request)
+		if (compiled == nil) != (uncompiled == nil) || (compiled != nil && compiled.ID != uncompiled.ID) {
+			t.Errorf("%s: compiled matched %v, uncompiled %v", name, compiled, uncompiled)
+		}
+	}
+	// Every sample rule is matched by some request, so the comparison covers each of them
+	for i := 1; i <= 7; i++ {
+		if !matchedRules[i] {
+			t.Errorf("rule %d is not matched by any sample request", i)
+		}
+	}
+}
+
+func TestCompiledConditions(t *testing.T) {
+	leaf := func(targetType repository.TargetType, method repository.TargetMethod, name string, value string) repository.Condition {
+		condition := repository.Condition{Type: targetType, Method: method, Value: &value}
+		if name != "" {
+			condition.Name = &name
+		}
+		return condition
+	}
+	ignoreCase := func(condition repository.Condition) repository.Condition {
+		condition.IgnoreCase = true
+		return condition
+	}
+	negate := func(condition repository.Condition) repository.Condition {
+		condition.Negate = true
+		return condition
+	}
+	partner := leaf(repository.Header, repository.Contains, "Referer", "PARTNER")
+	free := leaf(repository.Cookie, repository.Match, "plan", "free")
+	invalid := leaf(repository.Query, repository.Regex, "ref", "(")
+	footer := leaf(repository.Query, repository.Match, "ref", "footer")
+	tests := []struct {
+		name      string
+		condition repository.Condition
+		matches   bool
+	}{
+		{"case sensitive", partner, false},
+		{"ignore case", ignoreCase(partner), true},
+		{"ignore case regex", ignoreCase(leaf(repository.Header, repository.Regex, "referer", `^HTTPS://PARTNER\.`)), true},
+		{"ignore case match", ignoreCase(leaf(repository.Cookie, repository.Match, "plan", "FREE")), true},
+		{"negate", negate(free), false},
+		{"negate missing cookie", negate(leaf(repository.Cookie, repository.Match, "team", "a")), true},
+		{"invalid regex", invalid, false},
+		{"negated invalid regex", negate(invalid), false},
+		{"and", repository.Condition{And: []repository.Condition{free, footer}}, true},
+		{"and with a miss", repository.Condition{And: []repository.Condition{free, partner}}, false},
+		{"and with invalid", repository.Condition{And: []repository.Condition{free, invalid}}, false},
+		{"empty and", repository.Condition{And: []repository.Condition{}}, false},
+		{"or", repository.Condition{Or: []repository.Condition{partner, footer}}, true},
+		{"or with invalid", repository.Condition{Or: []repository.Condition{invalid, footer}}, true},
+		{"or without a match", repository.Condition{Or: []repository.Condition{partner, negate(free)}}, false},
+		{"not", repository.Condition{Not: &partner}, true},
+		{"nested", repository.Condition{And: []repository.Condition{
+			{Or: []repository.Condition{partner, {Not: &footer}}},
+			free,
+		}}, false},
+		{"nested negation", repository.Condition{Not: &repository.Condition{And: []repository.Condition{free, negate(footer)}}}, true},
+	}
+	request := sampleRequest()
+	request.Headers = request.Headers.Clone()
+	request.Headers.Set("Referer", "https://partner.example.com/")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redirects := []repository.Redirect{{ID: 1, Condition: &test.condition}}
+			visit := request
+			if matched := Compile(redirects).Match(&visit) != nil; matched != test.matches {
+				t.Errorf("matched = %v, want %v", matched, test.matches)
+			}
+			visit = request
+			if matched := evaluate(&test.condition, &visit); matched != test.matches {
+				t.Errorf("reference evaluation = %v, want %v", matched, test.matches)
+			}
+		})
+	}
+}
+
+// BenchmarkCompiled measures matching with the compiled rule sets the redirect handler uses
+func BenchmarkCompiled(b *testing.B) {
+	request := sampleRequest()
+	for _, count := range []int{1, 10, 50} {
+		set := Compile(sampleRedirects(count))
+		b.Run(strconv.Itoa(count)+" rules", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				// Copy the request so the lazily parsed user agent is not reused between iterations
+				visit := request
+				set.Match(&visit)
+			}
+		})
+	}
+}
+
+// BenchmarkUncompiled measures compiling the rules on every request
+func BenchmarkUncompiled(b *testing.B) {
+	request := sampleRequest()
+	for _, count := range []int{1, 10, 50} {
+		redirects := sampleRedirects(count)
+		b.Run(strconv.Itoa(count)+" rules", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Match(redirects, request)
+			}
+		})
+	}
+}
+
+// sampleRequest is a visit that matches none of the sample rules, so every rule is evaluated
+func sampleRequest() Request {
+	headers := http.Header{}
+	headers.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36")
+	headers.Set("Accept-Language", "en-US,en;q=0.9")
+	headers.Set("Referer", "https://news.example.com/article")
+	return Request{
+		Headers: headers,
+		Cookies: map[string]string{"session": "abc", "plan": "free"},
+		Query:   url.Values{"utm_source": {"newsletter"}, "ref": {"footer"}},
+		IP:      "203.0.113.7",
+		Country: "US",
+		Time:    time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+// sampleRedirects mixes the target types and methods, including case insensitive, negated and compound rules
+func sampleRedirects(count int) []repository.Redirect {
+	text := func(value string) *string { return &value }
+	conditions := []repository.Condition{
+		{Type: repository.Header, Method: repository.Regex, Name: text("Accept-Language"), Value: text(`^(de|fr)(-[A-Z]{2})?`)},
+		{Type: repository.Header, Method: repository.Contains, Name: text("referer"), Value: text("PARTNER"), IgnoreCase: true},
+		{Type: repository.Cookie, Method: repository.Match, Name: text("plan"), Value: text("free"), Negate: true},
+		{Type: repository.Query, Method: repository.StartsWith, Name: text("utm_source"), Value: text("ads")},
+		{Type: repository.Country, Method: repository.Match, Value: text("DE")},
+		{And: []repository.Condition{
+			{Type: repository.Device, Method: repository.Match, Value: text("mobile")},
+			{Type: repository.Header, Method: repository.Regex, Name: text("User-Agent"), Value: text(`iphone|ipad`), IgnoreCase: true},
+		}},
+		{Or: []repository.Condition{
+			{Type: repository.Query, Method: repository.EndsWith, Name: text("ref"), Value: text("header")},
+			{Not: &repository.Condition{Type: repository.Country, Method: repository.Regex, Value: text(`^[A-Z]{2}$`)}},
+		}},
+	}
+	redirects := make([]repository.Redirect, count)
+	for i := range redirects {
+		condition := conditions[i%len(conditions)]
+		redirects[i] = repository.Redirect{ID: i + 1, RedirectURL: "https://example.com/", Priority: i, Condition: &condition}
+	}
+	return redirects
+}
@@ -0,0 +1,183 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"link-shortener-backend/src/repository"
+	"regexp"
+	"strings"
+)
+
+const (
+	// maxConditionDepth is how deep groups may be nested
+	maxConditionDepth = 8
+	// maxConditionNodes is the most groups and leaves a single rule may have
+	maxConditionNodes = 32
+)
+
+var (
+	ErrConditionMissing = errors.New("rules need a condition")
+	ErrConditionNode    = errors.New("a condition must set exactly one of and, or, not and type")
+	ErrConditionEmpty   = errors.New("and and or groups need at least one condition")
+	ErrConditionDepth   = errors.New("conditions are nested too deeply")
+	ErrConditionSize    = errors.New("rules may have at most 32 conditions")
+	ErrConditionType    = errors.New("condition type must be header, cookie, query, country, device, os, browser or schedule")
+	ErrConditionMethod  = errors.New("condition method must be match, regex, contains, startsWith or endsWith")
+	ErrConditionName    = errors.New("header, cookie and query conditions need a name")
+	ErrConditionValue   = errors.New("conditions need a value")
+	ErrConditionRegex   = errors.New("condition regex is invalid")
+	ErrConditionCountry = errors.New("country conditions must match a two letter ISO country code like DE")
+	ErrConditionDevice  = errors.New("device conditions must match desktop, mobile, tablet or bot")
+)
+
+// countryCode is the form of the country codes GeoIP lookups return
+var countryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// devices are the values ParseAgent reports for the device
+var devices = map[string]bool{
+	DeviceDesktop: true,
+	DeviceMobile:  true,
+	DeviceTablet:  true,
+	DeviceBot:     true,
+}
+
+var targetTypes = map[repository.TargetType]bool{
+	repository.Header:   true,
+	repository.Cookie:   true,
+	repository.Query:    true,
+	repository.Country:  true,
+	repository.Device:   true,
+	repository.OS:       true,
+	repository.Browser:  true,
+	repository.Schedule: true,
+}
+
+var targetMethods = map[repository.TargetMethod]bool{
+	repository.Match:      true,
+	repository.Regex:      true,
+	repository.Contains:   true,
+	repository.StartsWith: true,
+	repository.EndsWith:   true,
+}
+
+// LegacyCondition builds the single leaf condition of a rule from its target fields
+func LegacyCondition(redirect repository.Redirect) *repository.Condition {
+	return &repository.Condition{
+		Type:     redirect.TargetType,
+		Method:   redirect.TargetMethod,
+		Name:     redirect.TargetName,
+		Value:    redirect.TargetValue,
+		Schedule: redirect.Schedule,
+	}
+}
+
+// ValidateCondition checks a condition tree before it is stored. Leaves without a method default to match
+func ValidateCondition(condition *repository.Condition) error {
+	if condition == nil {
+		return ErrConditionMissing
+	}
+	nodes := 0
+	return validateNode(condition, 1, &nodes)
+}
+
+func validateNode(condition *repository.Condition, depth int, nodes *int) error {
+	if depth > maxConditionDepth {
+		return ErrConditionDepth
+	}
+	*nodes++
+	if *nodes > maxConditionNodes {
+		return ErrConditionSize
+	}
+	set := 0
+	if condition.And != nil {
+		set++
+	}
+	if condition.Or != nil {
+		set++
+	}
+	if condition.Not != nil {
+		set++
+	}
+	if condition.Type != "" {
+		set++
+	}
+	if set != 1 {
+		return ErrConditionNode
+	}
+
+	switch {
+	case condition.Not != nil:
+		return validateNode(condition.Not, depth+1, nodes)
+	case condition.Type == "":
+		children := condition.And
+		if condition.Or != nil {
+			children = condition.Or
+		}
+		if len(children) == 0 {
+			return ErrConditionEmpty
+		}
+		for i := range children {
+			if err := validateNode(&children[i], depth+1, nodes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if !targetTypes[condition.Type] {
+		return ErrConditionType
+	}
+	if condition.Type == repository.Schedule {
+		// The method does not apply to schedules, but it is kept in the target columns
+		condition.Method = repository.Match
+		condition.Name, condition.Value = nil, nil
+		condition.IgnoreCase, condition.Negate = false, false
+		return ValidateSchedule(condition.Schedule)
+	}
+	condition.Schedule = nil
+	if condition.Method == "" {
+		condition.Method = repository.Match
+	}
+	if !targetMethods[condition.Method] {
+		return ErrConditionMethod
+	}
+	if condition.Value == nil {
+		return ErrConditionValue
+	}
+	if condition.Method == repository.Regex {
+		if _, err := compilePattern(*condition.Value, condition.IgnoreCase); err != nil {
+			// The regexp error names the part of the pattern that is wrong
+			return fmt.Errorf("%w: %v", ErrConditionRegex, err)
+		}
+	} else {
+		value := normalizeValue(condition.Type, *condition.Value)
+		condition.Value = &value
+	}
+	if condition.Type == repository.Country && condition.Method == repository.Match && !countryCode.MatchString(*condition.Value) {
+		return ErrConditionCountry
+	}
+	if condition.Type == repository.Device && condition.Method == repository.Match && !devices[*condition.Value] {
+		return ErrConditionDevice
+	}
+	switch condition.Type {
+	case repository.Header, repository.Cookie, repository.Query:
+		if condition.Name == nil || *condition.Name == "" {
+			return ErrConditionName
+		}
+	default:
+		condition.Name = nil
+	}
+	return nil
+}
+
+// normalizeValue brings the value of a condition that is not a regex into the form the target is reported in,
+// country codes are upper case and the device, os and browser of agents lower case
+func normalizeValue(targetType repository.TargetType, value string) string {
+	switch targetType {
+	case repository.Country:
+		return strings.ToUpper(value)
+	case repository.Device, repository.OS, repository.Browser:
+		return strings.ToLower(value)
+	}
+	return value
+}
@@ -0,0 +1,94 @@
+package rules
+
+import (
+	"errors"
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"testing"
+)
+
+func text(value string) *string {
+	return &value
+}
+
+// leafRule validates the leaf and returns a rule with it as the only condition
+func leafRule(t *testing.T, condition repository.Condition) ([]repository.Redirect, error) {
+	t.Helper()
+	if err := ValidateCondition(&condition); err != nil {
+		return nil, err
+	}
+	return []repository.Redirect{{ID: 1, RedirectURL: "https://example.com/", Condition: &condition}}, nil
+}
+
+func TestCountryConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition repository.Condition
+		country   string
+		err       error
+		matches   bool
+	}{
+		{"lower case code", repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("de")}, "DE", nil, true},
+		{"upper case code", repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("DE")}, "DE", nil, true},
+		{"other country", repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("de")}, "FR", nil, false},
+		{"lower case prefix", repository.Condition{Type: repository.Country, Method: repository.StartsWith, Value: text("d")}, "DE", nil, true},
+		{"country name", repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("Germany")}, "DE", ErrConditionCountry, false},
+		{"three letter code", repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("DEU")}, "DE", ErrConditionCountry, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redirects, err := leafRule(t, test.condition)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			request := Request{Country: test.country}
+			if matched := Compile(redirects).Match(&request) != nil; matched != test.matches {
+				t.Errorf("matched = %v, want %v", matched, test.matches)
+			}
+		})
+	}
+}
+
+func TestStoredLowerCaseCountry(t *testing.T) {
+	// Rules stored before country codes were normalized still match
+	redirects := []repository.Redirect{{ID: 1, Condition: &repository.Condition{Type: repository.Country, Method: repository.Match, Value: text("de")}}}
+	request := Request{Country: "DE"}
+	if Compile(redirects).Match(&request) == nil {
+		t.Error("stored lower case country code does not match")
+	}
+}
+
+func TestAgentConditions(t *testing.T) {
+	iphone := "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	tests := []struct {
+		name      string
+		condition repository.Condition
+		err       error
+		matches   bool
+	}{
+		{"device", repository.Condition{Type: repository.Device, Method: repository.Match, Value: text("Mobile")}, nil, true},
+		{"other device", repository.Condition{Type: repository.Device, Method: repository.Match, Value: text("TABLET")}, nil, false},
+		{"unknown device", repository.Condition{Type: repository.Device, Method: repository.Match, Value: text("phone")}, ErrConditionDevice, false},
+		{"device prefix", repository.Condition{Type: repository.Device, Method: repository.StartsWith, Value: text("Mob")}, nil, true},
+		{"os", repository.Condition{Type: repository.OS, Method: repository.Match, Value: text("iOS")}, nil, true},
+		{"browser", repository.Condition{Type: repository.Browser, Method: repository.Contains, Value: text("Safari")}, nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			redirects, err := leafRule(t, test.condition)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("err = %v, want %v", err, test.err)
+			}
+			if err != nil {
+				return
+			}
+			request := Request{Headers: http.Header{"User-Agent": {iphone}}}
+			if matched := Compile(redirects).Match(&request) != nil; matched != test.matches {
+				t.Errorf("matched = %v, want %v", matched, test.matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package rules
+
+import (
+	"link-shortener-backend/src/repository"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Request holds the parts of a visit that redirect rules are matched against. It is built from the
+// incoming request on redirects and from a sample request on dry runs
+type Request struct {
+	Headers http.Header
+	Cookies map[string]string
+	Query   url.Values
+	IP      string
+	// Country is the ISO code of the visitor's country, it is only looked up when a rule needs it
+	Country string
+	// Time is when the visit happened, schedule rules are evaluated against it
+	Time time.Time
+
+	agent *Agent
+}
+
+// Agent returns the device, operating system and browser of the visitor, parsed on first use
+func (r *Request) Agent() Agent {
+	if r.agent == nil {
+		agent := ParseAgent(r.Headers.Get("User-Agent"))
+		r.agent = &agent
+	}
+	return *r.agent
+}
+
+// NewRequest builds the rule request for an incoming http request, ip is the client ip as seen by the router
+// and now the time of the visit
+func NewRequest(r *http.Request, ip string, now time.Time) Request {
+	cookies := map[string]string{}
+	for _, cookie := range r.Cookies() {
+		// The first cookie wins, browsers send the most specific path first
+		if _, ok := cookies[cookie.Name]; !ok {
+			cookies[cookie.Name] = cookie.Value
+		}
+	}
+	return Request{Headers: r.Header, Cookies: cookies, Query: r.URL.Query(), IP: ip, Time: now}
+}
+
+// Match returns the first rule that matches the request, nil when none does. It compiles the rules on
+// every call, redirects use the RuleSet cached for the link instead
+func Match(redirects []repository.Redirect, request Request) *repository.Redirect {
+	return Compile(redirects).Match(&request)
+}
+
+// condition returns the condition tree of a rule, rules stored before conditions existed only have target fields
+func condition(redirect repository.Redirect) *repository.Condition {
+	if redirect.Condition != nil {
+		return redirect.Condition
+	}
+	return LegacyCondition(redirect)
+}
+
+// ForwardQuery appends the incoming query parameters to the destination. Parameters already on the
+// destination win, so visitors can not override tracking parameters set by the link owner
+func ForwardQuery(destination string, query url.Values) string {
+	if len(query) == 0 {
+		return destination
+	}
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return destination
+	}
+	existing := parsed.Query()
+	forwarded := url.Values{}
+	for name, values := range query {
+		if _, ok := existing[name]; !ok {
+			forwarded[name] = values
+		}
+	}
+	if len(forwarded) == 0 {
+		return destination
+	}
+	// Append instead of re-encoding, so the order and encoding of the destination's own query are kept
+	if parsed.RawQuery != "" {
+		parsed.RawQuery += "&"
+	}
+	parsed.RawQuery += forwarded.Encode()
+	return parsed.String()
+}
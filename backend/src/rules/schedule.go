@@ -0,0 +1,138 @@
+package rules
+
+import (
+	"errors"
+	"link-shortener-backend/src/repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrScheduleMissing  = errors.New("schedule rules need a schedule")
+	ErrScheduleDay      = errors.New("schedule days must be mon, tue, wed, thu, fri, sat or sun")
+	ErrScheduleTime     = errors.New("schedule from and to must be times of day like 09:30")
+	ErrScheduleWindow   = errors.New("schedule from and to must not be equal")
+	ErrScheduleRange    = errors.New("schedule end must be after start")
+	ErrScheduleTimezone = errors.New("schedule timezone must be an IANA timezone like Europe/Berlin")
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// locations caches loaded timezones, time.LoadLocation reads the zoneinfo file on every call
+var locations sync.Map
+
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if cached, ok := locations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+	loaded, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loaded)
+	return loaded, nil
+}
+
+// ValidateSchedule checks the days, times and timezone of a schedule
+func ValidateSchedule(schedule *repository.RedirectSchedule) error {
+	if schedule == nil {
+		return ErrScheduleMissing
+	}
+	if schedule.Start != nil && schedule.End != nil && !schedule.End.After(*schedule.Start) {
+		return ErrScheduleRange
+	}
+	for _, day := range schedule.Days {
+		if _, ok := weekdays[strings.ToLower(day)]; !ok {
+			return ErrScheduleDay
+		}
+	}
+	from, err := minuteOfDay(schedule.From, 0)
+	if err != nil {
+		return err
+	}
+	to, err := minuteOfDay(schedule.To, 24*60)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return ErrScheduleWindow
+	}
+	if _, err := location(schedule.Timezone); err != nil {
+		return ErrScheduleTimezone
+	}
+	return nil
+}
+
+// ScheduleActive reports whether the time is inside the absolute and the weekly window of the schedule
+func ScheduleActive(schedule repository.RedirectSchedule, now time.Time) bool {
+	if schedule.Start != nil && now.Before(*schedule.Start) {
+		return false
+	}
+	if schedule.End != nil && !now.Before(*schedule.End) {
+		return false
+	}
+	if len(schedule.Days) == 0 && schedule.From == "" && schedule.To == "" {
+		return true
+	}
+
+	loc, err := location(schedule.Timezone)
+	if err != nil {
+		return false
+	}
+	from, err := minuteOfDay(schedule.From, 0)
+	if err != nil {
+		return false
+	}
+	to, err := minuteOfDay(schedule.To, 24*60)
+	if err != nil {
+		return false
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+	if from < to {
+		return onDay(schedule.Days, today) && minute >= from && minute < to
+	}
+	// The window runs past midnight, the early hours belong to the window that started the day before
+	yesterday := (today + 6) % 7
+	return (onDay(schedule.Days, today) && minute >= from) || (onDay(schedule.Days, yesterday) && minute < to)
+}
+
+func onDay(days []string, weekday time.Weekday) bool {
+	if len(days) == 0 {
+		return true
+	}
+	for _, day := range days {
+		if weekdays[strings.ToLower(day)] == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// minuteOfDay parses a "15:04" time of day into minutes after midnight, empty values use the fallback
+func minuteOfDay(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, ErrScheduleTime
+	}
+	return parsed.Hour()*60 + parsed.Minute(), nil
+}
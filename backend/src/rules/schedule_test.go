@@ -0,0 +1,100 @@
+package rules
+
+import (
+	"errors"
+	"link-shortener-backend/src/repository"
+	"testing"
+	"time"
+	// The timezone cases work without zoneinfo files installed on the host
+	_ "time/tzdata"
+)
+
+func at(value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func timePointer(value string) *time.Time {
+	parsed := at(value)
+	return &parsed
+}
+
+func TestScheduleActive(t *testing.T) {
+	// 2024-06-03 is a Monday
+	tests := []struct {
+		name     string
+		schedule repository.RedirectSchedule
+		now      string
+		active   bool
+	}{
+		{"empty schedule", repository.RedirectSchedule{}, "2024-06-03T12:00:00Z", true},
+
+		{"inside window", repository.RedirectSchedule{From: "09:00", To: "17:00"}, "2024-06-03T09:00:00Z", true},
+		{"window end is exclusive", repository.RedirectSchedule{From: "09:00", To: "17:00"}, "2024-06-03T17:00:00Z", false},
+		{"before window", repository.RedirectSchedule{From: "09:00", To: "17:00"}, "2024-06-03T08:59:00Z", false},
+
+		{"overnight evening", repository.RedirectSchedule{Days: []string{"mon"}, From: "22:00", To: "06:00"}, "2024-06-03T23:00:00Z", true},
+		{"overnight morning after", repository.RedirectSchedule{Days: []string{"mon"}, From: "22:00", To: "06:00"}, "2024-06-04T05:59:00Z", true},
+		{"overnight end is exclusive", repository.RedirectSchedule{Days: []string{"mon"}, From: "22:00", To: "06:00"}, "2024-06-04T06:00:00Z", false},
+		{"overnight morning of the day", repository.RedirectSchedule{Days: []string{"mon"}, From: "22:00", To: "06:00"}, "2024-06-03T05:00:00Z", false},
+		{"overnight evening of the next day", repository.RedirectSchedule{Days: []string{"mon"}, From: "22:00", To: "06:00"}, "2024-06-04T23:00:00Z", false},
+		{"overnight sunday into monday", repository.RedirectSchedule{Days: []string{"sun"}, From: "22:00", To: "06:00"}, "2024-06-03T01:00:00Z", true},
+
+		{"until 24:00", repository.RedirectSchedule{From: "18:00", To: "24:00"}, "2024-06-03T23:59:00Z", true},
+		{"24:00 ends at midnight", repository.RedirectSchedule{From: "18:00", To: "24:00"}, "2024-06-04T00:00:00Z", false},
+		{"from midnight", repository.RedirectSchedule{To: "06:00"}, "2024-06-03T00:00:00Z", true},
+
+		{"on day", repository.RedirectSchedule{Days: []string{"Mon", "wed"}}, "2024-06-03T12:00:00Z", true},
+		{"not on day", repository.RedirectSchedule{Days: []string{"tue"}}, "2024-06-03T12:00:00Z", false},
+
+		{"timezone window", repository.RedirectSchedule{From: "09:00", To: "17:00", Timezone: "Europe/Berlin"}, "2024-06-03T07:30:00Z", true},
+		{"timezone window closed", repository.RedirectSchedule{From: "09:00", To: "17:00", Timezone: "Europe/Berlin"}, "2024-06-03T15:30:00Z", false},
+		{"timezone winter offset", repository.RedirectSchedule{From: "09:00", To: "17:00", Timezone: "Europe/Berlin"}, "2024-01-08T15:30:00Z", true},
+		{"timezone moves the day", repository.RedirectSchedule{Days: []string{"tue"}, Timezone: "Asia/Tokyo"}, "2024-06-03T20:00:00Z", true},
+		{"day without timezone", repository.RedirectSchedule{Days: []string{"tue"}}, "2024-06-03T20:00:00Z", false},
+
+		{"before start", repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-10T00:00:00Z")}, "2024-05-31T23:59:59Z", false},
+		{"at start", repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-10T00:00:00Z")}, "2024-06-01T00:00:00Z", true},
+		{"before end", repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-10T00:00:00Z")}, "2024-06-09T23:59:59Z", true},
+		{"end is exclusive", repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-10T00:00:00Z")}, "2024-06-10T00:00:00Z", false},
+		{"bounds and window", repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), From: "09:00", To: "17:00"}, "2024-06-03T18:00:00Z", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if active := ScheduleActive(test.schedule, at(test.now)); active != test.active {
+				t.Errorf("active = %v, want %v", active, test.active)
+			}
+		})
+	}
+}
+
+func TestValidateSchedule(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule *repository.RedirectSchedule
+		err      error
+	}{
+		{"missing", nil, ErrScheduleMissing},
+		{"valid", &repository.RedirectSchedule{Days: []string{"Mon", "fri"}, From: "22:00", To: "06:00", Timezone: "Europe/Berlin"}, nil},
+		{"until 24:00", &repository.RedirectSchedule{From: "18:00", To: "24:00"}, nil},
+		{"only bounds", &repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-02T00:00:00Z")}, nil},
+		{"unknown day", &repository.RedirectSchedule{Days: []string{"monday"}}, ErrScheduleDay},
+		{"invalid from", &repository.RedirectSchedule{From: "25:00"}, ErrScheduleTime},
+		{"invalid to", &repository.RedirectSchedule{To: "noon"}, ErrScheduleTime},
+		{"24:00 to 24:00", &repository.RedirectSchedule{From: "24:00", To: "24:00"}, ErrScheduleWindow},
+		{"empty window", &repository.RedirectSchedule{From: "09:00", To: "09:00"}, ErrScheduleWindow},
+		{"end before start", &repository.RedirectSchedule{Start: timePointer("2024-06-02T00:00:00Z"), End: timePointer("2024-06-01T00:00:00Z")}, ErrScheduleRange},
+		{"end at start", &repository.RedirectSchedule{Start: timePointer("2024-06-01T00:00:00Z"), End: timePointer("2024-06-01T00:00:00Z")}, ErrScheduleRange},
+		{"unknown timezone", &repository.RedirectSchedule{Timezone: "Mars/Olympus"}, ErrScheduleTimezone},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ValidateSchedule(test.schedule); !errors.Is(err, test.err) {
+				t.Errorf("err = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package rules
+
+import "link-shortener-backend/src/repository"
+
+// TotalWeight is the sum of the weights of the variants
+func TotalWeight(variants []repository.Variant) int {
+	total := 0
+	for _, variant := range variants {
+		total += variant.Weight
+	}
+	return total
+}
+
+// PickVariant returns the variant a roll in [0, TotalWeight) falls on, each variant covers a range as wide as its weight
+func PickVariant(variants []repository.Variant, roll int) *repository.Variant {
+	for i := range variants {
+		if roll < variants[i].Weight {
+			return &variants[i]
+		}
+		roll -= variants[i].Weight
+	}
+	return nil
+}
+
+// FindVariant returns the variant with the id, nil when the link has no such variant anymore
+func FindVariant(variants []repository.Variant, id int) *repository.Variant {
+	for i := range variants {
+		if variants[i].ID == id {
+			return &variants[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package safety
+
+import (
+	"bufio"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Blocklist is a Reputation read from a local file. Every line lists a hostname, which also blocks its
+// subdomains, or a url prefix like https://example.com/phish. An optional reason follows after whitespace,
+// lines starting with # are comments
+//
+//	# phishing kit seen 2024-05
+//	login-example.com phishing
+//	https://files.example.org/payload malware
+type Blocklist struct {
+	path string
+
+	mu       sync.RWMutex
+	hosts    map[string]string
+	prefixes []blockedPrefix
+}
+
+type blockedPrefix struct {
+	prefix string
+	reason string
+}
+
+// LoadBlocklist reads the blocklist file at path
+func LoadBlocklist(path string) (*Blocklist, error) {
+	blocklist := &Blocklist{path: path}
+	if err := blocklist.Reload(); err != nil {
+		return nil, err
+	}
+	return blocklist, nil
+}
+
+// Reload reads the file again, the previous entries stay in use when it can not be read
+func (b *Blocklist) Reload() error {
+	file, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hosts := map[string]string{}
+	var prefixes []blockedPrefix
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		entry, reason := fields[0], strings.Join(fields[1:], " ")
+		if reason == "" {
+			reason = "blocklisted"
+		}
+		if strings.Contains(entry, "://") {
+			prefixes = append(prefixes, blockedPrefix{prefix: strings.ToLower(entry), reason: reason})
+		} else {
+			hosts[normalizeHost(entry)] = reason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.hosts = hosts
+	b.prefixes = prefixes
+	return nil
+}
+
+func (b *Blocklist) Lookup(u *url.URL) (string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	// example.com also blocks www.example.com and every other subdomain
+	host := normalizeHost(u.Hostname())
+	for host != "" {
+		if reason, ok := b.hosts[host]; ok {
+			return reason, nil
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	raw := strings.ToLower(u.String())
+	for _, blocked := range b.prefixes {
+		if strings.HasPrefix(raw, blocked.prefix) {
+			return blocked.reason, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,173 @@
+// Package safety decides whether a url may be used as the destination of a link
+package safety
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidURL     = errors.New("destination must be an absolute URL")
+	ErrScheme         = errors.New("destination scheme is not allowed")
+	ErrLoop           = errors.New("destination points back to a short link")
+	ErrPrivateNetwork = errors.New("destination points to a private network")
+	ErrListed         = errors.New("destination is listed as unsafe")
+)
+
+// Reputation looks up urls known for malware or phishing
+type Reputation interface {
+	// Lookup returns why the url is listed, "" when it is not
+	Lookup(u *url.URL) (string, error)
+}
+
+// None is the Reputation used without a blocklist, it lists nothing
+type None struct{}
+
+func (None) Lookup(u *url.URL) (string, error) {
+	return "", nil
+}
+
+// Checker runs the checks every destination has to pass: an allowed scheme, no loop back to the shortener,
+// no private network and no listing by the reputation checker. Hostnames are not resolved, their
+// addresses can change after the check anyway
+type Checker struct {
+	// Schemes are the allowed schemes, http and https need a host
+	Schemes []string
+	// Hosts are the hostnames of the shortener itself
+	Hosts []string
+	// IsOwnDomain reports whether the host is a custom domain of the shortener, it may be nil
+	IsOwnDomain func(host string) (bool, error)
+	Reputation  Reputation
+}
+
+// Default checks http and https urls without a blocklist
+func Default() *Checker {
+	return &Checker{Schemes: []string{"http", "https"}, Reputation: None{}}
+}
+
+// Check returns nil when the url is a safe destination. The checks fail with one of the errors above,
+// Unsafe tells them apart from errors of the lookups
+func (c *Checker) Check(raw string) error {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Scheme == "" {
+		return ErrInvalidURL
+	}
+	scheme := strings.ToLower(parsed.Scheme)
+	if !c.allowed(scheme) {
+		return ErrScheme
+	}
+	if (scheme == "http" || scheme == "https") && parsed.Host == "" {
+		return ErrInvalidURL
+	}
+
+	if host := normalizeHost(parsed.Hostname()); host != "" {
+		for _, own := range c.Hosts {
+			if host == normalizeHost(own) {
+				return ErrLoop
+			}
+		}
+		if c.IsOwnDomain != nil {
+			own, err := c.IsOwnDomain(host)
+			if err != nil {
+				return err
+			}
+			if own {
+				return ErrLoop
+			}
+		}
+		if privateHost(host) {
+			return ErrPrivateNetwork
+		}
+	}
+
+	if c.Reputation == nil {
+		return nil
+	}
+	reason, err := c.Reputation.Lookup(parsed)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return fmt.Errorf("%w: %s", ErrListed, reason)
+	}
+	return nil
+}
+
+func (c *Checker) allowed(scheme string) bool {
+	for _, allowed := range c.Schemes {
+		if strings.EqualFold(allowed, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unsafe reports whether the error of Check means the url failed a check
+func Unsafe(err error) bool {
+	return errors.Is(err, ErrInvalidURL) || errors.Is(err, ErrScheme) || errors.Is(err, ErrLoop) ||
+		errors.Is(err, ErrPrivateNetwork) || errors.Is(err, ErrListed)
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// privateHost reports whether the host names a loopback, private, link local or otherwise internal address
+func privateHost(host string) bool {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") ||
+		strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal") {
+		return true
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		// Browsers also accept IPv4 addresses written like 2130706433 or 0x7f.1
+		var ok bool
+		if addr, ok = parseLooseIPv4(host); !ok {
+			return false
+		}
+	}
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() || sharedAddressSpace.Contains(addr) || thisNetwork.Contains(addr)
+}
+
+var (
+	// sharedAddressSpace is used for carrier grade NAT
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	thisNetwork        = netip.MustParsePrefix("0.0.0.0/8")
+)
+
+// parseLooseIPv4 parses the shorthand IPv4 forms of inet_aton, with one to four decimal, octal or hex parts
+func parseLooseIPv4(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		values[i] = value
+	}
+	// Every part but the last is a single byte, the last one fills the remaining bytes
+	var ip uint64
+	for _, value := range values[:len(values)-1] {
+		if value > 0xff {
+			return netip.Addr{}, false
+		}
+		ip = ip<<8 | value
+	}
+	remaining := 8 * uint(5-len(values))
+	last := values[len(values)-1]
+	if last >= 1<<remaining {
+		return netip.Addr{}, false
+	}
+	ip = ip<<remaining | last
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
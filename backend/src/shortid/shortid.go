@@ -0,0 +1,204 @@
+package shortid
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Alphabet is the base62 character set used by every generator
+const Alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+const (
+	StrategyRandom   = "random"
+	StrategySequence = "sequence"
+	StrategyHashids  = "hashids"
+)
+
+var ErrInvalidId = errors.New("invalid short id")
+
+// Generator produces candidate short ids for new links.
+// seq is the id the link will be stored under and attempt counts the collisions seen so far for it
+type Generator interface {
+	Generate(seq int64, attempt int) (string, error)
+}
+
+// New returns the generator for the given strategy name
+func New(strategy string, salt string, minLength int) (Generator, error) {
+	if minLength <= 0 {
+		minLength = 6
+	}
+	switch strategy {
+	case "", StrategyRandom:
+		return NewRandom(minLength), nil
+	case StrategySequence:
+		return NewSequence(), nil
+	case StrategyHashids:
+		return NewHashids(salt, minLength), nil
+	}
+	return nil, fmt.Errorf("unknown short id strategy %q", strategy)
+}
+
+// Random generates ids from crypto randomness. The length grows once the number of links
+// passes LoadFactor of the keyspace, and every second collision for the same link adds a character
+type Random struct {
+	MinLength  int
+	LoadFactor float64
+}
+
+func NewRandom(minLength int) *Random {
+	return &Random{MinLength: minLength, LoadFactor: 0.01}
+}
+
+// Length returns the id length used for the given sequence number and attempt
+func (r *Random) Length(seq int64, attempt int) int {
+	length := r.MinLength
+	for float64(seq) > r.LoadFactor*math.Pow(float64(len(Alphabet)), float64(length)) {
+		length++
+	}
+	return length + attempt/2
+}
+
+func (r *Random) Generate(seq int64, attempt int) (string, error) {
+	length := r.Length(seq, attempt)
+	id := make([]byte, 0, length)
+	buf := make([]byte, length*2)
+	// Bytes above the largest multiple of 62 are rejected so every character is equally likely
+	limit := byte(256 - 256%len(Alphabet))
+	for len(id) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if b >= limit {
+				continue
+			}
+			id = append(id, Alphabet[int(b)%len(Alphabet)])
+			if len(id) == length {
+				break
+			}
+		}
+	}
+	return string(id), nil
+}
+
+// Sequence base62 encodes the link id, which makes ids short and unique but guessable
+type Sequence struct{}
+
+func NewSequence() *Sequence {
+	return &Sequence{}
+}
+
+func (s *Sequence) Generate(seq int64, attempt int) (string, error) {
+	return encode(big.NewInt(seq), Alphabet, 1), nil
+}
+
+// Hashids is a reversible encoding of the link id in the spirit of Hashids.
+// The id is multiplied by a salt derived factor modulo 62^length and written with a salt shuffled alphabet,
+// so consecutive links do not get consecutive ids but Decode can still recover the link id
+type Hashids struct {
+	MinLength int
+	alphabet  string
+	factor    *big.Int
+}
+
+func NewHashids(salt string, minLength int) *Hashids {
+	h := fnv.New64a()
+	h.Write([]byte(salt))
+	// The factor has to be coprime with 62 to be invertible
+	factor := h.Sum64() | 1
+	for factor%31 == 0 {
+		factor += 2
+	}
+	return &Hashids{
+		MinLength: minLength,
+		alphabet:  shuffle(Alphabet, salt),
+		factor:    new(big.Int).SetUint64(factor),
+	}
+}
+
+func (h *Hashids) Generate(seq int64, attempt int) (string, error) {
+	if seq < 0 {
+		return "", ErrInvalidId
+	}
+	value := big.NewInt(seq)
+	length := h.MinLength
+	if digits := len(encode(value, Alphabet, 1)); digits > length {
+		length = digits
+	}
+	modulus := h.modulus(length)
+	value.Mul(value, h.factor).Mod(value, modulus)
+	return encode(value, h.alphabet, length), nil
+}
+
+// Decode returns the link id an id was generated from
+func (h *Hashids) Decode(id string) (int64, error) {
+	if len(id) < h.MinLength {
+		return 0, ErrInvalidId
+	}
+	value := new(big.Int)
+	base := big.NewInt(int64(len(h.alphabet)))
+	for _, char := range id {
+		index := strings.IndexRune(h.alphabet, char)
+		if index < 0 {
+			return 0, ErrInvalidId
+		}
+		value.Mul(value, base).Add(value, big.NewInt(int64(index)))
+	}
+	modulus := h.modulus(len(id))
+	inverse := new(big.Int).ModInverse(new(big.Int).Mod(h.factor, modulus), modulus)
+	value.Mul(value, inverse).Mod(value, modulus)
+	if !value.IsInt64() {
+		return 0, ErrInvalidId
+	}
+	seq := value.Int64()
+	// Only ids that Generate could have produced are valid
+	if generated, _ := h.Generate(seq, 0); generated != id {
+		return 0, ErrInvalidId
+	}
+	return seq, nil
+}
+
+func (h *Hashids) modulus(length int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(int64(len(h.alphabet))), big.NewInt(int64(length)), nil)
+}
+
+// encode writes value in the base of the alphabet, left padded to at least length characters
+func encode(value *big.Int, alphabet string, length int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	rest := new(big.Int).Set(value)
+	digit := new(big.Int)
+	var out []byte
+	for rest.Sign() > 0 {
+		rest.DivMod(rest, base, digit)
+		out = append(out, alphabet[digit.Int64()])
+	}
+	for len(out) < length {
+		out = append(out, alphabet[0])
+	}
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+// shuffle deterministically reorders the alphabet based on the salt
+func shuffle(alphabet string, salt string) string {
+	chars := []byte(alphabet)
+	if salt == "" {
+		return alphabet
+	}
+	for i, v, p := len(chars)-1, 0, 0; i > 0; i-- {
+		v %= len(salt)
+		n := int(salt[v])
+		p += n
+		j := (n + v + p) % i
+		chars[i], chars[j] = chars[j], chars[i]
+		v++
+	}
+	return string(chars)
+}